@@ -0,0 +1,260 @@
+package q
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const signatureHeader = "signature"
+
+// adminMaxAge is how old a command may be before it is rejected, commands seen within it are rejected as replays
+const adminMaxAge = 30 * time.Second
+
+// AdminSettings controls who may administer this process
+type AdminSettings struct {
+	Secrets map[string][]byte   // The secret each app name signs its commands with
+	Allow   map[string][]string // The commands each app name may issue, "*" matches any app or command
+}
+
+// AdminCommand is a command sent to a process with Admin
+type AdminCommand struct {
+	Command string `json:"command"`         // scale, close, pause, resume, stats or loglevel
+	Topic   string `json:"topic,omitempty"` // The server to scale, close, pause or resume
+	N       int    `json:"n,omitempty"`     // The number of instances to scale by, negative to scale down
+	Level   string `json:"level,omitempty"` // The log level to set
+	App     string `json:"app"`             // The app name of the sender, filled in by Admin
+	Time    int64  `json:"time"`            // When the command was sent in unix nanos, filled in by Admin
+	ID      string `json:"id"`              // Unique id of the command, filled in by Admin
+}
+
+var adminSubs []*Subscription
+var adminSeen = make(map[string]time.Time)
+var adminLock sync.Mutex
+
+// adminSubject returns the subject a process with the app id or name target receives admin commands on
+func adminSubject(target string) string {
+	return "$Q.admin." + target
+}
+
+// EnableAdmin lets other processes send this process admin commands, addressed to its AppID or AppName
+func EnableAdmin(settings AdminSettings) error {
+	if len(settings.Secrets) == 0 {
+		return errors.New("admin secrets must not be empty")
+	}
+	for app, secret := range settings.Secrets {
+		if len(secret) == 0 {
+			return fmt.Errorf("admin secret for '%s' must not be empty", app)
+		}
+	}
+	if _, err := Open(); err != nil {
+		return err
+	}
+	adminLock.Lock()
+	defer adminLock.Unlock()
+	if adminSubs != nil {
+		return errors.New("admin already enabled")
+	}
+	conn := nc
+	callback := func(m *nats.Msg) {
+		reply, err := settings.run(m.Data)
+		if m.Reply == "" {
+			return
+		}
+		if err != nil {
+			reply = []byte("error:" + err.Error())
+		}
+		conn.Publish(m.Reply, reply)
+	}
+	for _, target := range []string{AppID(), AppName()} {
+		sub, err := conn.Subscribe(adminSubject(target), callback)
+		if err != nil {
+			disableAdmin()
+			return err
+		}
+		s := &Subscription{subject: sub.Subject, subscription: sub}
+		subscribersLock.Lock()
+		subscribers[sub] = s // Keeps the connection open while there are no servers
+		subscribersLock.Unlock()
+		adminSubs = append(adminSubs, s)
+	}
+	return nil
+}
+
+// DisableAdmin stops accepting admin commands
+func DisableAdmin() {
+	adminLock.Lock()
+	defer adminLock.Unlock()
+	disableAdmin()
+}
+
+func disableAdmin() {
+	for _, s := range adminSubs {
+		s.Unsubscribe()
+	}
+	adminSubs = nil
+}
+
+// Admin sends cmd signed with this app's secret to the process with the app id or name target and returns its
+// reply, if several processes share an app name the first reply is returned
+func Admin(target string, secret []byte, cmd AdminCommand, timeout time.Duration) ([]byte, error) {
+	if !IsValidRequestName(target) {
+		return nil, fmt.Errorf("'%s' was not a valid admin target", target)
+	}
+	if nc == nil {
+		if _, err := Open(); err != nil {
+			return nil, err
+		}
+	}
+	cmd.App = AppName()
+	cmd.Time = time.Now().UnixNano()
+	cmd.ID = NewID()
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+	m, err := nc.Request(adminSubject(target), buildMessage(NewID(), data, Header{Key: signatureHeader, Value: sign(secret, data)}), timeout)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(string(m.Data), "error:") {
+		return nil, errors.New(string(m.Data[6:]))
+	}
+	return m.Data, nil
+}
+
+// sign returns the signature of data with secret
+func sign(secret, data []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// allows returns true if app may issue command
+func (a AdminSettings) allows(app, command string) bool {
+	for _, name := range []string{app, "*"} {
+		for _, c := range a.Allow[name] {
+			if c == command || c == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// run authenticates and runs the admin command in message
+func (a AdminSettings) run(message []byte) ([]byte, error) {
+	headers, data := ParseMessage(message)
+	var cmd AdminCommand
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return nil, err
+	}
+	secret, ok := a.Secrets[cmd.App]
+	if !ok || !hmac.Equal([]byte(headers[signatureHeader]), []byte(sign(secret, data))) {
+		return nil, errors.New("invalid signature")
+	}
+	if age := time.Since(time.Unix(0, cmd.Time)); age > adminMaxAge || age < -adminMaxAge {
+		return nil, errors.New("command expired")
+	}
+	if !seenOnce(cmd.ID) {
+		return nil, errors.New("command replayed")
+	}
+	if !a.allows(cmd.App, cmd.Command) {
+		return nil, fmt.Errorf("app '%s' may not %s", cmd.App, cmd.Command)
+	}
+	logf(LogInfo, "admin %s from %s: %+v", cmd.Command, cmd.App, cmd)
+	switch cmd.Command {
+	case "scale":
+		return []byte("ok"), Scale(cmd.Topic, cmd.N)
+	case "close":
+		return []byte("ok"), Close(cmd.Topic)
+	case "pause":
+		return []byte("ok"), Pause(cmd.Topic)
+	case "resume":
+		return []byte("ok"), Resume(cmd.Topic)
+	case "stats":
+		return json.Marshal(StatsSnapshot())
+	case "loglevel":
+		level, err := ParseLogLevel(cmd.Level)
+		if err != nil {
+			return nil, err
+		}
+		SetLogLevel(level)
+		return []byte("ok"), nil
+	}
+	return nil, fmt.Errorf("unknown admin command '%s'", cmd.Command)
+}
+
+// seenOnce returns true the first time id is seen within adminMaxAge
+func seenOnce(id string) bool {
+	if id == "" {
+		return false
+	}
+	adminLock.Lock()
+	defer adminLock.Unlock()
+	now := time.Now()
+	for seen, at := range adminSeen {
+		if now.Sub(at) > 2*adminMaxAge { // Commands older than this are rejected as expired anyway
+			delete(adminSeen, seen)
+		}
+	}
+	if _, ok := adminSeen[id]; ok {
+		return false
+	}
+	adminSeen[id] = now
+	return true
+}
+
+// Pause stops the instances of topic receiving requests until Resume is called, for queue servers other
+// processes in the queue take the requests
+func Pause(topic string) error {
+	subscriptionsLock.Lock()
+	defer subscriptionsLock.Unlock()
+	services, ok := subscriptions[topic]
+	if !ok {
+		return fmt.Errorf("server '%s' was not found", topic)
+	}
+	for _, s := range services {
+		if !s.paused {
+			s.pause()
+		}
+	}
+	return nil
+}
+
+// Resume restarts the instances of a paused topic
+func Resume(topic string) error {
+	subscriptionsLock.Lock()
+	defer subscriptionsLock.Unlock()
+	services, ok := subscriptions[topic]
+	if !ok {
+		return fmt.Errorf("server '%s' was not found", topic)
+	}
+	for i, s := range services {
+		if s.paused && s.options.partitioned && i > 0 {
+			s.paused = false // Only the first instance of a partitioned server subscribes
+		} else if s.paused {
+			if err := s.subscribe(); err != nil {
+				return err
+			}
+			s.paused = false
+		}
+	}
+	return nil
+}
+
+// pause unsubscribes the instance from its topic, subscriptionsLock must be held
+func (s *server) pause() {
+	s.lock.Lock()
+	s.subscription.Unsubscribe()
+	s.lock.Unlock()
+	s.paused = true
+}
@@ -0,0 +1,127 @@
+package q
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdmin(t *testing.T) {
+	secret := []byte("secret")
+	svr, err := NewTopic("test.admin", SimpleServer)
+	if err != nil {
+		t.Errorf("TestAdmin NewTopic got %s", err)
+	}
+	defer svr.Close()
+	if err = EnableAdmin(AdminSettings{Secrets: map[string][]byte{AppName(): secret, "intruder": []byte("other")}, Allow: map[string][]string{AppName(): {"scale", "stats", "pause", "resume", "loglevel"}}}); err != nil {
+		t.Errorf("TestAdmin EnableAdmin got %s", err)
+	}
+	defer DisableAdmin()
+
+	if _, err = Admin(AppID(), secret, AdminCommand{Command: "scale", Topic: "test.admin", N: 2}, time.Second); err != nil {
+		t.Errorf("TestAdmin Admin scale got %s", err)
+	}
+	if svr.Count() != 3 {
+		t.Errorf("TestAdmin expected 3 instances got %d", svr.Count())
+	}
+	reply, err := Admin(AppID(), secret, AdminCommand{Command: "stats"}, time.Second)
+	if err != nil {
+		t.Errorf("TestAdmin Admin stats got %s", err)
+	}
+	var stats map[string]Stats
+	if err = json.Unmarshal(reply, &stats); err != nil {
+		t.Errorf("TestAdmin Unmarshal got %s", err)
+	}
+	if len(stats["test.admin"].Instances) != 3 {
+		t.Errorf("TestAdmin expected stats for 3 instances got %+v", stats)
+	}
+	if _, err = Admin(AppID(), secret, AdminCommand{Command: "close", Topic: "test.admin"}, time.Second); err == nil {
+		t.Error("TestAdmin expected close to be refused")
+	}
+	if _, err = Admin(AppID(), []byte("wrong"), AdminCommand{Command: "stats"}, time.Second); err == nil {
+		t.Error("TestAdmin expected wrong secret to be refused")
+	}
+	// An app signing with its own secret cannot claim to be another app
+	cmd := AdminCommand{Command: "stats", App: AppName(), Time: time.Now().UnixNano(), ID: NewID()}
+	if _, err = sendAdmin(cmd, []byte("other")); err == nil {
+		t.Error("TestAdmin expected impersonation to be refused")
+	}
+	cmd.ID = NewID()
+	if _, err = sendAdmin(cmd, secret); err != nil {
+		t.Errorf("TestAdmin expected signed command to run got %s", err)
+	}
+	if _, err = sendAdmin(cmd, secret); err == nil {
+		t.Error("TestAdmin expected replayed command to be refused")
+	}
+	if _, err = Admin(AppID(), secret, AdminCommand{Command: "loglevel", Level: "warn"}, time.Second); err != nil {
+		t.Errorf("TestAdmin Admin loglevel got %s", err)
+	}
+	if GetLogLevel() != LogWarn {
+		t.Errorf("TestAdmin expected log level warn got %s", GetLogLevel())
+	}
+	SetLogLevel(LogInfo)
+}
+
+// sendAdmin sends cmd as it is, signed with secret
+func sendAdmin(cmd AdminCommand, secret []byte) ([]byte, error) {
+	data, _ := json.Marshal(cmd)
+	m, err := nc.Request(adminSubject(AppID()), buildMessage(NewID(), data, Header{Key: signatureHeader, Value: sign(secret, data)}), time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(string(m.Data), "error:") {
+		return nil, errors.New(string(m.Data[6:]))
+	}
+	return m.Data, nil
+}
+
+func TestPauseResume(t *testing.T) {
+	svr, err := NewTopic("test.admin.pause", SimpleServer, InitialScale(2))
+	if err != nil {
+		t.Errorf("TestPauseResume NewTopic got %s", err)
+	}
+	defer svr.Close()
+	if err = Pause("test.admin.pause"); err != nil {
+		t.Errorf("TestPauseResume Pause got %s", err)
+	}
+	if _, err = Request("", "test.admin.pause", []byte("x"), 50*time.Millisecond); err == nil {
+		t.Error("TestPauseResume expected paused server not to reply")
+	}
+	if err = Resume("test.admin.pause"); err != nil {
+		t.Errorf("TestPauseResume Resume got %s", err)
+	}
+	if _, err = Request("", "test.admin.pause", []byte("x"), time.Second); err != nil {
+		t.Errorf("TestPauseResume expected resumed server to reply got %s", err)
+	}
+	if err = Pause("test.admin.none"); err == nil {
+		t.Error("TestPauseResume expected error pausing unknown server")
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	if l, err := ParseLogLevel("ERROR"); err != nil || l != LogError {
+		t.Errorf("TestParseLogLevel expected error level got %s, %v", l, err)
+	}
+	if _, err := ParseLogLevel("loud"); err == nil {
+		t.Error("TestParseLogLevel expected invalid level to fail")
+	}
+}
+
+func TestAdminAfterCloseAll(t *testing.T) {
+	secret := []byte("secret")
+	settings := AdminSettings{Secrets: map[string][]byte{AppName(): secret}, Allow: map[string][]string{AppName(): {"stats"}}}
+	if err := EnableAdmin(settings); err != nil {
+		t.Errorf("TestAdminAfterCloseAll EnableAdmin got %s", err)
+	}
+	CloseAll()
+	// CloseAll stops admin so it can be enabled again
+	if err := EnableAdmin(settings); err != nil {
+		t.Errorf("TestAdminAfterCloseAll EnableAdmin after CloseAll got %s", err)
+	}
+	defer DisableAdmin()
+	if _, err := Admin(AppID(), secret, AdminCommand{Command: "stats"}, time.Second); err != nil {
+		t.Errorf("TestAdminAfterCloseAll Admin got %s", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 var appName string = BaseFilename(os.Args[0])
 var appID string = NewID()
+var appVersion string
 
 // AppID is the unique ID of this instance of the application
 func AppID() string {
@@ -23,3 +24,15 @@ func SetAppName(name string) Option {
 		appName = name
 	}
 }
+
+// AppVersion returns the version of this application
+func AppVersion() string {
+	return appVersion
+}
+
+// SetAppVersion sets the application version announced to other processes
+func SetAppVersion(version string) Option {
+	return func(t *Options) {
+		appVersion = version
+	}
+}
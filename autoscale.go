@@ -0,0 +1,145 @@
+package q
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// AutoScaleSettings configures automatic scaling of a server between Min and Max instances.  A server is scaled
+// up when any enabled signal is above its up threshold, and down only when every enabled signal is at or below its
+// down threshold, so the down thresholds should be lower than the up thresholds.
+type AutoScaleSettings struct {
+	Min      int           // Fewest instances, default 1
+	Max      int           // Most instances
+	Step     int           // Instances added or removed each time, default 1
+	Interval time.Duration // How often the signals are checked, default 1s
+	Cooldown time.Duration // Least time between scaling, default 10s
+
+	UpPending   int // Scale up when the average pending messages per instance is above, 0 disables
+	DownPending int // Scale down when the average pending messages per instance is at or below
+
+	UpInFlight   float64 // Scale up when the average requests in flight or queued per instance is above, 0 disables
+	DownInFlight float64 // Scale down when the average requests in flight or queued per instance is at or below
+
+	UpLatency   time.Duration // Scale up when the average handler latency is above, 0 disables
+	DownLatency time.Duration // Scale down when the average handler latency is at or below
+
+	// OnScale is called each time the server is scaled
+	OnScale func(topic string, from, to int, reason string)
+}
+
+// AutoScale scales a server's instances up and down with its load
+func AutoScale(settings AutoScaleSettings) Option {
+	if settings.Min < 1 {
+		settings.Min = 1
+	}
+	if settings.Max < settings.Min {
+		log.Fatal(fmt.Sprintf("AutoScale max '%d' is not valid, must be >= min '%d'", settings.Max, settings.Min))
+	}
+	if settings.Step < 1 {
+		settings.Step = 1
+	}
+	if settings.Interval <= 0 {
+		settings.Interval = time.Second
+	}
+	if settings.Cooldown <= 0 {
+		settings.Cooldown = 10 * time.Second
+	}
+	return func(t *Options) {
+		t.autoScale = &settings
+	}
+}
+
+// load is the average load on a server's instances
+type load struct {
+	instances int
+	pending   float64
+	inFlight  float64
+	latency   time.Duration
+}
+
+// measure returns the average load of the instances of topic, or false if the server of generation has been closed
+func measure(topic string, generation int) (load, bool) {
+	subscriptionsLock.Lock()
+	services := append([]*server(nil), subscriptions[topic]...)
+	subscriptionsLock.Unlock()
+	if len(services) == 0 || services[0].generation != generation {
+		return load{}, false
+	}
+	l := load{instances: len(services)}
+	for _, s := range services {
+		l.pending += float64(s.pending())
+		l.inFlight += float64(s.inFlight() + s.queued())
+		s.lock.Lock()
+		l.latency += s.latency
+		s.lock.Unlock()
+	}
+	l.pending /= float64(len(services))
+	l.inFlight /= float64(len(services))
+	l.latency /= time.Duration(len(services))
+	return l, true
+}
+
+// scaleFor returns the change in instances wanted for load and the reason
+func (a AutoScaleSettings) scaleFor(l load) (int, string) {
+	if l.instances < a.Min {
+		return a.Min - l.instances, "below minimum"
+	}
+	if l.instances > a.Max {
+		return a.Max - l.instances, "above maximum"
+	}
+	var reason string
+	switch {
+	case a.UpPending > 0 && l.pending > float64(a.UpPending):
+		reason = fmt.Sprintf("pending %.1f > %d", l.pending, a.UpPending)
+	case a.UpInFlight > 0 && l.inFlight > a.UpInFlight:
+		reason = fmt.Sprintf("in flight %.1f > %.1f", l.inFlight, a.UpInFlight)
+	case a.UpLatency > 0 && l.latency > a.UpLatency:
+		reason = fmt.Sprintf("latency %s > %s", l.latency, a.UpLatency)
+	}
+	if reason != "" {
+		if l.instances+a.Step > a.Max {
+			return a.Max - l.instances, reason
+		}
+		return a.Step, reason
+	}
+	if a.UpPending == 0 && a.UpInFlight == 0 && a.UpLatency == 0 {
+		return 0, ""
+	}
+	if (a.UpPending > 0 && l.pending > float64(a.DownPending)) ||
+		(a.UpInFlight > 0 && l.inFlight > a.DownInFlight) ||
+		(a.UpLatency > 0 && l.latency > a.DownLatency) {
+		return 0, ""
+	}
+	if l.instances-a.Step < a.Min {
+		return a.Min - l.instances, "idle"
+	}
+	return -a.Step, "idle"
+}
+
+// autoScale scales the server of generation serving topic until it is closed
+func autoScale(topic string, generation int, settings AutoScaleSettings) {
+	ticker := time.NewTicker(settings.Interval)
+	defer ticker.Stop()
+	var last time.Time
+	for range ticker.C {
+		l, ok := measure(topic, generation)
+		if !ok {
+			return
+		}
+		n, reason := settings.scaleFor(l)
+		if n == 0 || time.Since(last) < settings.Cooldown && l.instances >= settings.Min && l.instances <= settings.Max {
+			continue
+		}
+		if err := Scale(topic, n); err != nil {
+			logf(LogWarn, "autoscale %s failed: %s", topic, err)
+			continue
+		}
+		last = time.Now()
+		logf(LogInfo, "autoscale %s from %d to %d instances: %s", topic, l.instances, l.instances+n, reason)
+		if settings.OnScale != nil {
+			settings.OnScale(topic, l.instances, l.instances+n, reason)
+		}
+	}
+}
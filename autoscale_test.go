@@ -0,0 +1,92 @@
+package q
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScaleFor(t *testing.T) {
+	settings := AutoScaleSettings{Min: 1, Max: 4, Step: 2, UpPending: 10, DownPending: 2}
+	if n, _ := settings.scaleFor(load{instances: 1, pending: 20}); n != 2 {
+		t.Errorf("Expected scale up by 2 got %d", n)
+	}
+	if n, _ := settings.scaleFor(load{instances: 3, pending: 20}); n != 1 {
+		t.Errorf("Expected scale up to max got %d", n)
+	}
+	if n, _ := settings.scaleFor(load{instances: 3, pending: 5}); n != 0 {
+		t.Errorf("Expected no scaling between thresholds got %d", n)
+	}
+	if n, _ := settings.scaleFor(load{instances: 2, pending: 1}); n != -1 {
+		t.Errorf("Expected scale down to min got %d", n)
+	}
+	if n, _ := settings.scaleFor(load{instances: 0}); n != 1 {
+		t.Errorf("Expected scale up to min got %d", n)
+	}
+	latency := AutoScaleSettings{Min: 1, Max: 4, Step: 1, UpLatency: time.Second, DownLatency: 100 * time.Millisecond}
+	if n, _ := latency.scaleFor(load{instances: 2, latency: 2 * time.Second}); n != 1 {
+		t.Errorf("Expected scale up on latency got %d", n)
+	}
+	if n, _ := latency.scaleFor(load{instances: 2, latency: 50 * time.Millisecond}); n != -1 {
+		t.Errorf("Expected scale down on latency got %d", n)
+	}
+}
+
+func TestAutoScale(t *testing.T) {
+	scaled := make(chan int, 10)
+	svr, err := NewQueue("test.autoscale", "queue", Sleepy, AutoScale(AutoScaleSettings{
+		Min: 1, Max: 3, Interval: 10 * time.Millisecond, Cooldown: 10 * time.Millisecond,
+		UpPending: 2, DownPending: 0,
+		OnScale: func(topic string, from, to int, reason string) { scaled <- to },
+	}))
+	if err != nil {
+		t.Errorf("TestAutoScale NewQueue got %s", err)
+	}
+	defer svr.Close()
+
+	for i := 0; i < 10; i++ {
+		Send("", "test.autoscale", []byte{})
+	}
+	select {
+	case n := <-scaled:
+		if n != 2 {
+			t.Errorf("TestAutoScale expected scale up to 2 got %d", n)
+		}
+	case <-time.After(time.Second):
+		t.Error("TestAutoScale did not scale up")
+	}
+	deadline := time.After(2 * time.Second)
+	for svr.Count() != 1 {
+		select {
+		case <-scaled:
+		case <-deadline:
+			t.Errorf("TestAutoScale did not scale back down, %d servers", svr.Count())
+			return
+		}
+	}
+}
+
+func TestAutoScaleAfterRemove(t *testing.T) {
+	scaled := make(chan int, 10)
+	svr, err := NewQueue("test.autoscale.remove", "queue", Sleepy, AutoScale(AutoScaleSettings{
+		Min: 2, Max: 3, Interval: 10 * time.Millisecond,
+		OnScale: func(topic string, from, to int, reason string) { scaled <- to },
+	}))
+	if err != nil {
+		t.Errorf("TestAutoScaleAfterRemove NewQueue got %s", err)
+	}
+	defer svr.Close()
+
+	if n := <-scaled; n != 2 {
+		t.Errorf("TestAutoScaleAfterRemove expected scale up to 2 got %d", n)
+	}
+	// Removing the first instance must not stop the server being scaled
+	removeInstance(svr.(*server))
+	select {
+	case n := <-scaled:
+		if n != 2 {
+			t.Errorf("TestAutoScaleAfterRemove expected scale back up to 2 got %d", n)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("TestAutoScaleAfterRemove did not scale after removing an instance, %d servers", Count("test.autoscale.remove"))
+	}
+}
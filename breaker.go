@@ -0,0 +1,229 @@
+package q
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a server's circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets requests through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails requests immediately
+	BreakerOpen
+	// BreakerHalfOpen lets a limited number of trial requests through
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// ErrCircuitOpen is returned by Request when the circuit breaker for the server is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerSettings configures the circuit breaker kept for each server name.  Only transport
+// failures such as timeouts count as failures, an error returned by a server's handler does not.
+type BreakerSettings struct {
+	ConsecutiveFailures int           // Open after this many failures in a row, 0 disables
+	FailureRate         float64       // Open when this fraction of requests in Window fail, 0 disables
+	MinRequests         int           // Requests needed in Window before FailureRate applies
+	Window              time.Duration // Period over which FailureRate is measured, default 10s
+	CoolDown            time.Duration // Time spent open before going half-open, default 5s
+	HalfOpenRequests    int           // Trial requests allowed while half-open, default 1
+
+	// OnStateChange is called each time a breaker changes state
+	OnStateChange func(serverName string, from, to BreakerState)
+}
+
+// CircuitBreaker enables a client side circuit breaker for each server name requested
+func CircuitBreaker(settings BreakerSettings) Option {
+	if settings.Window <= 0 {
+		settings.Window = 10 * time.Second
+	}
+	if settings.CoolDown <= 0 {
+		settings.CoolDown = 5 * time.Second
+	}
+	if settings.HalfOpenRequests < 1 {
+		settings.HalfOpenRequests = 1
+	}
+	return func(t *Options) {
+		t.breaker = &settings
+	}
+}
+
+type breaker struct {
+	name        string
+	settings    *BreakerSettings
+	state       BreakerState
+	consecutive int
+	requests    int
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+	trials      int
+}
+
+var breakers = make(map[string]*breaker)
+var breakersLock sync.Mutex
+var breakerChanges []func()
+
+// notifyBreakerChanges calls OnStateChange for changes made while breakersLock was held
+func notifyBreakerChanges() {
+	breakersLock.Lock()
+	changes := breakerChanges
+	breakerChanges = nil
+	breakersLock.Unlock()
+	for _, change := range changes {
+		change()
+	}
+}
+
+// GetBreakerState returns the circuit breaker state for serverName
+func GetBreakerState(serverName string) BreakerState {
+	defer notifyBreakerChanges()
+	breakersLock.Lock()
+	defer breakersLock.Unlock()
+	b, ok := breakers[serverName]
+	if !ok {
+		return BreakerClosed
+	}
+	b.update(time.Now())
+	return b.state
+}
+
+// BreakerStates returns the circuit breaker state of every server name requested
+func BreakerStates() map[string]BreakerState {
+	defer notifyBreakerChanges()
+	breakersLock.Lock()
+	defer breakersLock.Unlock()
+	now := time.Now()
+	states := make(map[string]BreakerState)
+	for name, b := range breakers {
+		b.update(now)
+		states[name] = b.state
+	}
+	return states
+}
+
+// ResetBreaker closes the circuit breaker for serverName
+func ResetBreaker(serverName string) {
+	defer notifyBreakerChanges()
+	breakersLock.Lock()
+	defer breakersLock.Unlock()
+	if b, ok := breakers[serverName]; ok {
+		b.setState(BreakerClosed, time.Now())
+	}
+}
+
+// allowRequest returns ErrCircuitOpen if serverName should not be requested, requestDone must be
+// called with the outcome of every request allowed
+func allowRequest(serverName string, settings *BreakerSettings) error {
+	if settings == nil {
+		return nil
+	}
+	defer notifyBreakerChanges()
+	breakersLock.Lock()
+	defer breakersLock.Unlock()
+	b, ok := breakers[serverName]
+	if !ok {
+		b = &breaker{name: serverName, windowStart: time.Now()}
+		breakers[serverName] = b
+	}
+	b.settings = settings
+	b.update(time.Now())
+	switch b.state {
+	case BreakerOpen:
+		return ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.trials >= settings.HalfOpenRequests {
+			return ErrCircuitOpen
+		}
+		b.trials++
+	}
+	return nil
+}
+
+// requestDone records the outcome of a request allowed by allowRequest
+func requestDone(serverName string, settings *BreakerSettings, failed bool) {
+	if settings == nil {
+		return
+	}
+	defer notifyBreakerChanges()
+	breakersLock.Lock()
+	defer breakersLock.Unlock()
+	b, ok := breakers[serverName]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	b.update(now)
+	if b.state == BreakerHalfOpen {
+		b.trials--
+		if failed {
+			b.setState(BreakerOpen, now)
+		} else {
+			b.setState(BreakerClosed, now)
+		}
+		return
+	}
+	if b.state != BreakerClosed {
+		return
+	}
+	b.requests++
+	if !failed {
+		b.consecutive = 0
+		return
+	}
+	b.failures++
+	b.consecutive++
+	s := b.settings
+	if s.ConsecutiveFailures > 0 && b.consecutive >= s.ConsecutiveFailures {
+		b.setState(BreakerOpen, now)
+	} else if s.FailureRate > 0 && b.requests >= s.MinRequests && float64(b.failures)/float64(b.requests) >= s.FailureRate {
+		b.setState(BreakerOpen, now)
+	}
+}
+
+// update moves an open breaker to half-open once the cool down is over and starts new windows
+func (b *breaker) update(now time.Time) {
+	if b.settings == nil {
+		return
+	}
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.settings.CoolDown {
+		b.setState(BreakerHalfOpen, now)
+	}
+	if now.Sub(b.windowStart) >= b.settings.Window {
+		b.windowStart = now
+		b.requests = 0
+		b.failures = 0
+	}
+}
+
+func (b *breaker) setState(state BreakerState, now time.Time) {
+	from := b.state
+	b.state = state
+	b.consecutive = 0
+	b.requests = 0
+	b.failures = 0
+	b.trials = 0
+	b.windowStart = now
+	if state == BreakerOpen {
+		b.openedAt = now
+	}
+	if from != state && b.settings != nil && b.settings.OnStateChange != nil {
+		onChange, name := b.settings.OnStateChange, b.name
+		breakerChanges = append(breakerChanges, func() { onChange(name, from, state) })
+	}
+}
@@ -0,0 +1,99 @@
+package q
+
+import (
+	"testing"
+	"time"
+)
+
+// forgetBreaker removes the breaker for serverName so the test can be run again from a closed breaker
+func forgetBreaker(serverName string) {
+	breakersLock.Lock()
+	delete(breakers, serverName)
+	breakersLock.Unlock()
+}
+
+func TestBreakerOpens(t *testing.T) {
+	defer forgetBreaker("test.breaker.opens")
+	settings := BreakerSettings{ConsecutiveFailures: 2, CoolDown: time.Hour, HalfOpenRequests: 1, Window: time.Hour}
+	for i := 0; i < 2; i++ {
+		if err := allowRequest("test.breaker.opens", &settings); err != nil {
+			t.Errorf("Expected request %d to be allowed, got %s", i, err)
+		}
+		requestDone("test.breaker.opens", &settings, true)
+	}
+	if GetBreakerState("test.breaker.opens") != BreakerOpen {
+		t.Errorf("Expected breaker to be open got %s", GetBreakerState("test.breaker.opens"))
+	}
+	if err := allowRequest("test.breaker.opens", &settings); err != ErrCircuitOpen {
+		t.Errorf("Expected ErrCircuitOpen got %v", err)
+	}
+	ResetBreaker("test.breaker.opens")
+	if GetBreakerState("test.breaker.opens") != BreakerClosed {
+		t.Errorf("Expected breaker to be closed after reset got %s", GetBreakerState("test.breaker.opens"))
+	}
+}
+
+func TestBreakerFailureRate(t *testing.T) {
+	defer forgetBreaker("test.breaker.rate")
+	settings := BreakerSettings{FailureRate: 0.5, MinRequests: 4, CoolDown: time.Hour, HalfOpenRequests: 1, Window: time.Hour}
+	for i, failed := range []bool{false, true, false, true} {
+		if err := allowRequest("test.breaker.rate", &settings); err != nil {
+			t.Errorf("Expected request %d to be allowed, got %s", i, err)
+		}
+		requestDone("test.breaker.rate", &settings, failed)
+	}
+	if GetBreakerState("test.breaker.rate") != BreakerOpen {
+		t.Errorf("Expected breaker to be open got %s", GetBreakerState("test.breaker.rate"))
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	defer forgetBreaker("test.breaker.half")
+	changes := make(chan BreakerState, 10)
+	settings := BreakerSettings{ConsecutiveFailures: 1, CoolDown: 10 * time.Millisecond, HalfOpenRequests: 1, Window: time.Hour,
+		OnStateChange: func(_ string, _, to BreakerState) { changes <- to }}
+	allowRequest("test.breaker.half", &settings)
+	requestDone("test.breaker.half", &settings, true)
+	time.Sleep(20 * time.Millisecond)
+	if GetBreakerState("test.breaker.half") != BreakerHalfOpen {
+		t.Errorf("Expected breaker to be half-open got %s", GetBreakerState("test.breaker.half"))
+	}
+	if err := allowRequest("test.breaker.half", &settings); err != nil {
+		t.Errorf("Expected trial request to be allowed, got %s", err)
+	}
+	if err := allowRequest("test.breaker.half", &settings); err != ErrCircuitOpen {
+		t.Errorf("Expected second trial request to be refused, got %v", err)
+	}
+	requestDone("test.breaker.half", &settings, false)
+	if GetBreakerState("test.breaker.half") != BreakerClosed {
+		t.Errorf("Expected breaker to be closed got %s", GetBreakerState("test.breaker.half"))
+	}
+	for _, expected := range []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerClosed} {
+		select {
+		case state := <-changes:
+			if state != expected {
+				t.Errorf("Expected state change to %s got %s", expected, state)
+			}
+		case <-time.After(100 * time.Millisecond):
+			t.Errorf("Expected state change to %s", expected)
+		}
+	}
+}
+
+func TestBreakerRequest(t *testing.T) {
+	defer forgetBreaker("test.breaker.request")
+	SetDefaultOptions(CircuitBreaker(BreakerSettings{ConsecutiveFailures: 1, CoolDown: time.Hour}))
+	defer SetDefaultOptions()
+
+	_, err := Request("", "test.breaker.request", []byte("message"), 10*time.Millisecond)
+	if err == nil || err == ErrCircuitOpen {
+		t.Errorf("Expected first request to time out, got %v", err)
+	}
+	_, err = Request("", "test.breaker.request", []byte("message"), 10*time.Millisecond)
+	if err != ErrCircuitOpen {
+		t.Errorf("Expected ErrCircuitOpen got %v", err)
+	}
+	if BreakerStates()["test.breaker.request"] != BreakerOpen {
+		t.Error("Expected test.breaker.request to be listed as open")
+	}
+}
@@ -0,0 +1,168 @@
+package q
+
+import (
+	"container/list"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const cacheControlHeader = "cacheControl"
+const cacheInvalidateSubject = "$Q.cache.invalidate"
+
+type cacheSettings struct {
+	ttl time.Duration
+	key KeyFunc
+}
+
+// Cache caches successful replies from serverName for ttl, key may be nil to use the RequestKey header or the message body
+func Cache(serverName string, ttl time.Duration, key KeyFunc) Option {
+	if key == nil {
+		key = defaultKey
+	}
+	return func(t *Options) {
+		caches := make(map[string]cacheSettings)
+		for k, v := range t.caches {
+			caches[k] = v
+		}
+		caches[serverName] = cacheSettings{ttl: ttl, key: key}
+		t.caches = caches
+	}
+}
+
+// CacheSize sets the maximum number of cached replies, the least recently used are evicted first, default is 1000
+func CacheSize(n int) Option {
+	return func(t *Options) {
+		t.cacheSize = n
+	}
+}
+
+// CacheControl adds a header to a server's reply setting how long clients may cache it, overriding the client's ttl.
+// A maxAge <= 0 stops the reply being cached.
+func CacheControl(reply []byte, maxAge time.Duration) []byte {
+	value := "no-store"
+	if maxAge > 0 {
+		value = "max-age=" + strconv.FormatFloat(maxAge.Seconds(), 'f', -1, 64)
+	}
+	return ReplyWithHeaders(reply, Header{Key: cacheControlHeader, Value: value})
+}
+
+// InvalidateCache evicts the reply cached for key from serverName's cache in every client process, an empty key evicts all of serverName's replies
+func InvalidateCache(serverName, key string) error {
+	if nc == nil {
+		if _, err := Open(); err != nil {
+			return err
+		}
+	}
+	evict(serverName, key)
+	return nc.Publish(cacheInvalidateSubject, buildMessage(NewID(), []byte(key), Header{Key: "serverName", Value: serverName}))
+}
+
+// ClearCache evicts every cached reply in this process
+func ClearCache() {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	cacheEntries = make(map[string]*list.Element)
+	cacheOrder.Init()
+}
+
+type cacheEntry struct {
+	serverName string
+	key        string
+	reply      []byte
+	expires    time.Time
+}
+
+var cacheEntries = make(map[string]*list.Element)
+var cacheOrder = list.New()
+var cacheLock sync.Mutex
+var cacheConn *nats.Conn
+
+// cacheGet returns the cached reply for key if it has not expired
+func cacheGet(serverName, key string) ([]byte, bool) {
+	watchInvalidations()
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	e, ok := cacheEntries[serverName+"\n"+key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		cacheOrder.Remove(e)
+		delete(cacheEntries, serverName+"\n"+key)
+		return nil, false
+	}
+	cacheOrder.MoveToFront(e)
+	return append([]byte(nil), entry.reply...), true
+}
+
+// cachePut caches reply for ttl unless the server's cacheControl header says otherwise
+func cachePut(serverName, key string, reply []byte, ttl time.Duration, cacheControl string, size int) {
+	switch {
+	case cacheControl == "no-store" || cacheControl == "no-cache":
+		return
+	case strings.HasPrefix(cacheControl, "max-age="):
+		seconds, err := strconv.ParseFloat(cacheControl[8:], 64)
+		if err != nil {
+			break
+		}
+		ttl = time.Duration(seconds * float64(time.Second))
+	}
+	if ttl <= 0 || size <= 0 {
+		return
+	}
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	k := serverName + "\n" + key
+	entry := &cacheEntry{serverName: serverName, key: key, reply: append([]byte(nil), reply...), expires: time.Now().Add(ttl)}
+	if e, ok := cacheEntries[k]; ok {
+		e.Value = entry
+		cacheOrder.MoveToFront(e)
+	} else {
+		cacheEntries[k] = cacheOrder.PushFront(entry)
+	}
+	for cacheOrder.Len() > size {
+		last := cacheOrder.Back()
+		cacheOrder.Remove(last)
+		delete(cacheEntries, last.Value.(*cacheEntry).serverName+"\n"+last.Value.(*cacheEntry).key)
+	}
+}
+
+// evict removes key, or all keys if empty, cached for serverName
+func evict(serverName, key string) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	if key != "" {
+		if e, ok := cacheEntries[serverName+"\n"+key]; ok {
+			cacheOrder.Remove(e)
+			delete(cacheEntries, serverName+"\n"+key)
+		}
+		return
+	}
+	for k, e := range cacheEntries {
+		if e.Value.(*cacheEntry).serverName == serverName {
+			cacheOrder.Remove(e)
+			delete(cacheEntries, k)
+		}
+	}
+}
+
+// watchInvalidations subscribes to cache invalidations on the current connection
+func watchInvalidations() {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	if nc == nil || cacheConn == nc {
+		return
+	}
+	_, err := nc.Subscribe(cacheInvalidateSubject, func(m *nats.Msg) {
+		headers, key := ParseMessage(m.Data)
+		evict(headers["serverName"], string(key))
+	})
+	if err == nil {
+		cacheConn = nc
+	}
+}
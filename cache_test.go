@@ -0,0 +1,94 @@
+package q
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	var calls int32
+	svr, err := NewTopic("test.cache", func(svr Server, topic string, message []byte) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		return []byte("cached"), nil
+	})
+	if err != nil {
+		t.Errorf("TestCache NewTopic got %s", err)
+	}
+	defer svr.Close()
+	SetDefaultOptions(Cache("test.cache", time.Minute, nil))
+	defer SetDefaultOptions()
+	defer ClearCache()
+
+	for i := 0; i < 3; i++ {
+		reply, err := Request("", "test.cache", []byte("key"), 100*time.Millisecond)
+		if err != nil || string(reply) != "cached" {
+			t.Errorf("TestCache expected cached got %s, %v", string(reply), err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("TestCache expected 1 call got %d", calls)
+	}
+	InvalidateCache("test.cache", "key")
+	Request("", "test.cache", []byte("key"), 100*time.Millisecond)
+	if calls != 2 {
+		t.Errorf("TestCache expected 2 calls after invalidation got %d", calls)
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	var calls int32
+	svr, err := NewTopic("test.cache.control", func(svr Server, topic string, message []byte) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		return CacheControl([]byte("fresh"), 0), nil
+	})
+	if err != nil {
+		t.Errorf("TestCacheControl NewTopic got %s", err)
+	}
+	defer svr.Close()
+	SetDefaultOptions(Cache("test.cache.control", time.Minute, nil))
+	defer SetDefaultOptions()
+
+	for i := 0; i < 2; i++ {
+		reply, err := Request("", "test.cache.control", []byte("key"), 100*time.Millisecond)
+		if err != nil || string(reply) != "fresh" {
+			t.Errorf("TestCacheControl expected fresh got %s, %v", string(reply), err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("TestCacheControl expected 2 calls got %d", calls)
+	}
+}
+
+func TestCacheSize(t *testing.T) {
+	defer ClearCache()
+	cachePut("test.cache.size", "a", []byte("a"), time.Minute, "", 2)
+	cachePut("test.cache.size", "b", []byte("b"), time.Minute, "", 2)
+	cacheGet("test.cache.size", "a")
+	cachePut("test.cache.size", "c", []byte("c"), time.Minute, "", 2)
+	if _, ok := cacheGet("test.cache.size", "b"); ok {
+		t.Error("Expected least recently used b to be evicted")
+	}
+	if _, ok := cacheGet("test.cache.size", "a"); !ok {
+		t.Error("Expected a to be cached")
+	}
+	cachePut("test.cache.size", "d", []byte("d"), time.Minute, "max-age=0.001", 2)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := cacheGet("test.cache.size", "d"); ok {
+		t.Error("Expected d to expire")
+	}
+}
+
+func TestReplyWithHeaders(t *testing.T) {
+	headers, reply := parseReply(ReplyWithHeaders([]byte("reply"), Header{Key: "a", Value: "b"}))
+	if string(reply) != "reply" {
+		t.Errorf("Expected reply got %s", string(reply))
+	}
+	if headers["a"] != "b" {
+		t.Errorf("Expected header a to be b got %s", headers["a"])
+	}
+	_, reply = parseReply([]byte("plain"))
+	if string(reply) != "plain" {
+		t.Errorf("Expected plain got %s", string(reply))
+	}
+}
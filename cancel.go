@@ -0,0 +1,55 @@
+package q
+
+import (
+	"fmt"
+)
+
+const cancelHeader = "cancel"
+
+// requestIDHeader identifies one request, unlike its trace id which is shared by every call made for a request
+const requestIDHeader = "requestId"
+
+// cancelSubject returns the subject servers for serverName receive cancel notices on
+func cancelSubject(serverName string) string {
+	return "$Q.cancel." + serverName
+}
+
+// Cancel asks the servers for serverName to cancel the context of requests they are handling for traceID
+func Cancel(traceID, serverName string) error {
+	if !IsValidRequestName((serverName)) {
+		return fmt.Errorf("'%s' was not a valid request name", serverName)
+	}
+	if nc == nil {
+		if _, err := Open(); err != nil {
+			return err
+		}
+	}
+	return nc.Publish(cancelSubject(serverName), buildMessage(traceID, nil, Header{Key: cancelHeader, Value: "true"}))
+}
+
+// CancelInstance asks the server instance with serverID to cancel the requests it is handling for traceID
+func CancelInstance(traceID, serverID string) error {
+	if nc == nil {
+		if _, err := Open(); err != nil {
+			return err
+		}
+	}
+	return nc.Publish(serverID, buildMessage(traceID, nil, Header{Key: cancelHeader, Value: "true"}))
+}
+
+// cancelRequest asks the servers for serverName to cancel the request with requestID, leaving the other requests
+// for traceID running
+func cancelRequest(traceID, requestID, serverName string) error {
+	if nc == nil {
+		if _, err := Open(); err != nil {
+			return err
+		}
+	}
+	return nc.Publish(cancelSubject(serverName), buildMessage(traceID, nil, Header{Key: cancelHeader, Value: "true"}, Header{Key: requestIDHeader, Value: requestID}))
+}
+
+// withRequestID returns a copy of headers with a new request id and the id
+func withRequestID(headers []Header) ([]Header, string) {
+	id := NewID()
+	return append(append([]Header(nil), headers...), Header{Key: requestIDHeader, Value: id}), id
+}
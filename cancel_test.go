@@ -0,0 +1,95 @@
+package q
+
+import (
+	"testing"
+	"time"
+)
+
+func Waiting(cancelled chan bool) Handler {
+	return func(svr Server, topic string, message []byte) ([]byte, error) {
+		select {
+		case <-svr.Context().Done():
+			cancelled <- true
+		case <-time.After(time.Second):
+			cancelled <- false
+		}
+		return []byte("finished"), nil
+	}
+}
+
+func TestCancelOnTimeout(t *testing.T) {
+	cancelled := make(chan bool, 1)
+	svr, err := NewQueue("test.cancel.timeout", "queue", Waiting(cancelled))
+	if err != nil {
+		t.Errorf("TestCancelOnTimeout NewQueue got %s", err)
+	}
+	defer svr.Close()
+
+	_, err = Request("cid", "test.cancel.timeout", []byte{}, 50*time.Millisecond)
+	if err == nil {
+		t.Error("TestCancelOnTimeout expected Request to time out")
+	}
+	if !<-cancelled {
+		t.Error("TestCancelOnTimeout expected the handler to be cancelled")
+	}
+}
+
+func TestCancelInstance(t *testing.T) {
+	cancelled := make(chan bool, 1)
+	svr, err := NewTopic("test.cancel.instance", Waiting(cancelled))
+	if err != nil {
+		t.Errorf("TestCancelInstance NewTopic got %s", err)
+	}
+	defer svr.Close()
+
+	Send("cid2", "test.cancel.instance", []byte{})
+	time.Sleep(20 * time.Millisecond)
+	CancelInstance("other", svr.ID())
+	CancelInstance("cid2", svr.ID())
+	if !<-cancelled {
+		t.Error("TestCancelInstance expected the handler to be cancelled")
+	}
+}
+
+func TestServerContext(t *testing.T) {
+	svr, err := NewTopic("test.cancel.context", SimpleServer)
+	if err != nil {
+		t.Errorf("TestServerContext NewTopic got %s", err)
+	}
+	defer svr.Close()
+	if svr.Context().Err() != nil {
+		t.Error("TestServerContext expected an open context outside a request")
+	}
+}
+
+func TestCancelSibling(t *testing.T) {
+	svr, err := NewTopic("test.cancel.sibling", func(svr Server, topic string, message []byte) ([]byte, error) {
+		select {
+		case <-svr.Context().Done():
+			return []byte("cancelled"), nil
+		case <-time.After(150 * time.Millisecond):
+			return []byte("finished"), nil
+		}
+	}, Workers(2, 0))
+	if err != nil {
+		t.Errorf("TestCancelSibling NewTopic got %s", err)
+	}
+	defer svr.Close()
+
+	// Calls sharing a trace id are cancelled separately
+	done := make(chan string, 1)
+	go func() {
+		reply, err := Request("shared", "test.cancel.sibling", []byte{}, time.Second)
+		if err != nil {
+			t.Errorf("TestCancelSibling Request got %s", err)
+		}
+		done <- string(reply)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if _, err = Request("shared", "test.cancel.sibling", []byte{}, 20*time.Millisecond); err == nil {
+		t.Error("TestCancelSibling expected Request to time out")
+	}
+	if reply := <-done; reply != "finished" {
+		t.Errorf("TestCancelSibling expected finished got %s", reply)
+	}
+}
@@ -2,13 +2,20 @@ package q
 
 import (
 	"bytes"
-	"errors"
+	"context"
 	"fmt"
 	"strings"
 	"time"
 	"unicode"
+
+	nats "github.com/nats-io/nats.go"
 )
 
+const replyHeadersPrefix = "headers:"
+
+// traceIDPrefix starts every message built by buildMessage
+const traceIDPrefix = "traceId:"
+
 // Header is a key/value pair to prepend to messages
 type Header struct {
 	Key   string
@@ -30,6 +37,11 @@ func IsValidRequestName(name string) bool {
 
 // Send sends a message to serverName
 func Send(traceID, serverName string, message []byte, headers ...Header) error {
+	return SendContext(context.Background(), traceID, serverName, message, headers...)
+}
+
+// SendContext sends a message to serverName, ctx bounds any wait for a rate limit
+func SendContext(ctx context.Context, traceID, serverName string, message []byte, headers ...Header) error {
 	if !IsValidRequestName((serverName)) {
 		return fmt.Errorf("'%s' was not a valid request name", serverName)
 	}
@@ -39,11 +51,25 @@ func Send(traceID, serverName string, message []byte, headers ...Header) error {
 	if traceID == "" {
 		traceID = NewID()
 	}
+	if err := waitRateLimit(ctx, serverName, defaultOptions); err != nil {
+		return err
+	}
 	return nc.Publish(serverName, buildMessage(traceID, message, headers...))
 }
 
 // Request sends a request to serverName and returns reply
 func Request(traceID, serverName string, message []byte, timeout time.Duration, headers ...Header) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	reply, err := RequestContext(ctx, traceID, serverName, message, headers...)
+	if err == context.DeadlineExceeded {
+		return nil, nats.ErrTimeout
+	}
+	return reply, err
+}
+
+// RequestContext sends a request to serverName and returns reply, ctx must have a deadline or be cancellable
+func RequestContext(ctx context.Context, traceID, serverName string, message []byte, headers ...Header) ([]byte, error) {
 	if !IsValidRequestName((serverName)) {
 		return nil, fmt.Errorf("'%s' was not a valid request name", serverName)
 	}
@@ -53,17 +79,86 @@ func Request(traceID, serverName string, message []byte, timeout time.Duration,
 	if traceID == "" {
 		traceID = NewID()
 	}
-	reply, err := nc.Request(serverName, buildMessage(traceID, message, headers...), timeout)
+	cache, cached := defaultOptions.caches[serverName]
+	var cacheKey string
+	if cached {
+		cacheKey = cache.key(serverName, message, headers)
+		if reply, ok := cacheGet(serverName, cacheKey); ok {
+			return reply, nil
+		}
+	}
+	var data []byte
+	var err error
+	if key, ok := defaultOptions.coalesce[serverName]; ok {
+		data, err = coalesce(ctx, serverName+"\n"+key(serverName, message, headers), func(shared context.Context) ([]byte, error) {
+			return request(shared, traceID, serverName, message, headers...)
+		})
+	} else {
+		data, err = request(ctx, traceID, serverName, message, headers...)
+	}
 	if err != nil {
 		return nil, err
 	}
-	var msg = string(reply.Data)
-	if msg[:6] == "error:" {
-		return nil, errors.New(msg[6:])
+	if strings.HasPrefix(string(data), "error:") {
+		return nil, parseError(data[6:])
+	}
+	replyHeaders, reply := parseReply(data)
+	if cached {
+		cachePut(serverName, cacheKey, reply, cache.ttl, replyHeaders[cacheControlHeader], defaultOptions.cacheSize)
+	}
+	return reply, nil
+}
+
+// request sends a request to serverName and returns the reply as it was sent by the server
+func request(ctx context.Context, traceID, serverName string, message []byte, headers ...Header) ([]byte, error) {
+	if err := waitRateLimit(ctx, serverName, defaultOptions); err != nil {
+		return nil, err
+	}
+	settings := defaultOptions.breaker
+	if err := allowRequest(serverName, settings); err != nil {
+		return nil, err
+	}
+	var reply *nats.Msg
+	var err error
+	headers, requestID := withRequestID(deadline(ctx, headers))
+	data := buildMessage(traceID, message, headers...)
+	if h, ok := defaultOptions.hedges[serverName]; ok && h.copies > 1 {
+		reply, err = hedgedRequest(ctx, serverName, data, h)
+	} else {
+		reply, err = nc.RequestWithContext(ctx, serverName, data)
+	}
+	requestDone(serverName, settings, err != nil && err != context.Canceled)
+	if err != nil {
+		if ctx.Err() != nil {
+			cancelRequest(traceID, requestID, serverName)
+		}
+		return nil, err
 	}
 	return reply.Data, nil
 }
 
+// ReplyWithHeaders prepends headers to a server's reply, Request removes them before returning the reply
+func ReplyWithHeaders(reply []byte, headers ...Header) []byte {
+	var sb strings.Builder
+	sb.WriteString(replyHeadersPrefix)
+	for _, header := range headers {
+		sb.WriteString("\n")
+		sb.WriteString(header.Key)
+		sb.WriteString(":")
+		sb.WriteString(header.Value)
+	}
+	sb.WriteString("\n\n")
+	return append([]byte(sb.String()), reply...)
+}
+
+// parseReply splits a reply into any headers added by ReplyWithHeaders and the reply itself
+func parseReply(data []byte) (map[string]string, []byte) {
+	if !bytes.HasPrefix(data, []byte(replyHeadersPrefix)) {
+		return map[string]string{}, data
+	}
+	return ParseMessage(data[len(replyHeadersPrefix):])
+}
+
 // ParseMessage breaks up message into headers and message string
 func ParseMessage(message []byte) (map[string]string, []byte) {
 	var headers = make(map[string]string)
@@ -86,7 +181,7 @@ func ParseMessage(message []byte) (map[string]string, []byte) {
 
 func buildMessage(traceID string, message []byte, headers ...Header) []byte {
 	var sb strings.Builder
-	sb.WriteString("traceId:")
+	sb.WriteString(traceIDPrefix)
 	sb.WriteString(traceID)
 	sb.WriteString("\nappId:")
 	sb.WriteString(appID)
@@ -0,0 +1,107 @@
+package q
+
+import (
+	"context"
+	"sync"
+)
+
+// KeyFunc returns the key identifying a request to serverName, used for coalescing and caching
+type KeyFunc func(serverName string, message []byte, headers []Header) string
+
+const requestKeyHeader = "requestKey"
+
+// RequestKey returns a header that sets the key identifying a request instead of its message body
+func RequestKey(key string) Header {
+	return Header{Key: requestKeyHeader, Value: key}
+}
+
+// defaultKey uses the RequestKey header if present, otherwise the message body
+func defaultKey(serverName string, message []byte, headers []Header) string {
+	for _, h := range headers {
+		if h.Key == requestKeyHeader {
+			return h.Value
+		}
+	}
+	return string(message)
+}
+
+// Coalesce collapses concurrent requests to serverName with the same key into one request whose reply
+// is shared by all callers.  key may be nil to use the RequestKey header or the message body.
+func Coalesce(serverName string, key KeyFunc) Option {
+	if key == nil {
+		key = defaultKey
+	}
+	return func(t *Options) {
+		coalesced := make(map[string]KeyFunc)
+		for k, v := range t.coalesce {
+			coalesced[k] = v
+		}
+		coalesced[serverName] = key
+		t.coalesce = coalesced
+	}
+}
+
+type flight struct {
+	done    chan struct{}
+	reply   []byte
+	err     error
+	panic   interface{}
+	waiters int
+	cancel  context.CancelFunc
+}
+
+var flights = make(map[string]*flight)
+var flightsLock sync.Mutex
+
+// coalesce calls fn unless a call with the same key is already in flight, in which case its result is shared.
+// fn is given a context of its own that is cancelled once every caller waiting for it has given up, so it runs
+// until the longest deadline among them, while each caller gives up only on its own ctx.
+func coalesce(ctx context.Context, key string, fn func(context.Context) ([]byte, error)) ([]byte, error) {
+	flightsLock.Lock()
+	f, ok := flights[key]
+	if !ok {
+		var shared context.Context
+		f = &flight{done: make(chan struct{})}
+		shared, f.cancel = context.WithCancel(context.Background())
+		flights[key] = f
+		go func() {
+			var reply []byte
+			var err error
+			var panicked interface{}
+			func() {
+				defer func() { panicked = recover() }()
+				reply, err = fn(shared)
+			}()
+			flightsLock.Lock()
+			f.reply, f.err, f.panic = reply, err, panicked
+			if flights[key] == f {
+				delete(flights, key)
+			}
+			flightsLock.Unlock()
+			f.cancel()
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	flightsLock.Unlock()
+
+	select {
+	case <-f.done:
+		if f.panic != nil {
+			panic(f.panic) // Raised in each caller so it is recovered where fn would have been called
+		}
+		return append([]byte(nil), f.reply...), f.err
+	case <-ctx.Done():
+		flightsLock.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			// Nobody is waiting any more, later callers start a new call
+			f.cancel()
+			if flights[key] == f {
+				delete(flights, key)
+			}
+		}
+		flightsLock.Unlock()
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,84 @@
+package q
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalesce(t *testing.T) {
+	var calls int32
+	svr, err := NewTopic("test.coalesce", func(svr Server, topic string, message []byte) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return []byte("shared"), nil
+	})
+	if err != nil {
+		t.Errorf("TestCoalesce NewTopic got %s", err)
+	}
+	defer svr.Close()
+	SetDefaultOptions(Coalesce("test.coalesce", nil))
+	defer SetDefaultOptions()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reply, err := Request("", "test.coalesce", []byte("key"), time.Second)
+			if err != nil || string(reply) != "shared" {
+				t.Errorf("TestCoalesce expected shared got %s, %v", string(reply), err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("TestCoalesce expected 1 call got %d", calls)
+	}
+}
+
+func TestDefaultKey(t *testing.T) {
+	if key := defaultKey("a", []byte("body"), nil); key != "body" {
+		t.Errorf("Expected body got %s", key)
+	}
+	if key := defaultKey("a", []byte("body"), []Header{RequestKey("id")}); key != "id" {
+		t.Errorf("Expected id got %s", key)
+	}
+}
+
+func TestCoalesceOwnDeadline(t *testing.T) {
+	svr, err := NewTopic("test.coalesce.deadline", Sleepy)
+	if err != nil {
+		t.Errorf("TestCoalesceOwnDeadline NewTopic got %s", err)
+	}
+	defer svr.Close()
+	SetDefaultOptions(Coalesce("test.coalesce.deadline", nil))
+	defer SetDefaultOptions()
+
+	short := make(chan error)
+	go func() {
+		_, err := Request("", "test.coalesce.deadline", []byte("key"), 20*time.Millisecond)
+		short <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	reply, err := Request("", "test.coalesce.deadline", []byte("key"), time.Second)
+	if err != nil || string(reply) != "awake" {
+		t.Errorf("TestCoalesceOwnDeadline expected awake got %s, %v", string(reply), err)
+	}
+	if err = <-short; err == nil {
+		t.Error("TestCoalesceOwnDeadline expected the short request to time out")
+	}
+}
+
+func TestCoalescePanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r != "oops" {
+			t.Errorf("TestCoalescePanic expected oops got %v", r)
+		}
+	}()
+	coalesce(context.Background(), "test.coalesce.panic", func(ctx context.Context) ([]byte, error) {
+		panic("oops")
+	})
+}
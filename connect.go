@@ -18,6 +18,43 @@ type Options struct {
 	privateSubs bool
 	scale       int
 	unsubscribe int
+	breaker     *BreakerSettings
+
+	rateLimits        map[string]rateLimit
+	rateLimitFailFast bool
+	hedges            map[string]hedge
+	coalesce          map[string]KeyFunc
+	caches            map[string]cacheSettings
+	cacheSize         int
+
+	pendingMsgs  int
+	pendingBytes int
+	slowConsumer func(subject string, dropped int)
+
+	workers     int
+	workerQueue int
+	autoScale   *AutoScaleSettings
+
+	closeOnPanic bool
+	middleware   []Middleware
+
+	handlerTimeout time.Duration
+	healthCheck    HealthCheckFunc
+
+	version     string
+	description string
+	owner       string
+	endpoints   map[string]EndpointSchema
+
+	deadLetter string
+	retry      *RetrySettings
+
+	maxInFlight   int
+	maxQueueDepth int
+	bulkheads     []*Bulkhead
+
+	partitioned    bool
+	partitionQueue int
 }
 
 // Option is a function definition for extensible options
@@ -52,6 +89,7 @@ func newOptions() *Options {
 		privateSubs: true,
 		scale:       1,
 		unsubscribe: -1,
+		cacheSize:   1000,
 	}
 }
 
@@ -69,25 +107,24 @@ func IsOpen() bool {
 	return nc != nil
 }
 
-// Open initiates the ability to send messages
+// Open initiates the ability to send messages and returns the default options overridden by opts
 func Open(opts ...Option) (*Options, error) {
+	copyOptions := *defaultOptions
+	options := &copyOptions
+	for _, o := range opts {
+		o(options)
+	}
 	if nc == nil {
 		var err error
-		copyOptions := *defaultOptions
-		options := &copyOptions
-		for _, o := range opts {
-			o(options)
-		}
-		nc, err = nats.Connect(options.connect, nats.Name(options.name), nats.Timeout(options.timeout))
+		nc, err = nats.Connect(options.connect, nats.Name(options.name), nats.Timeout(options.timeout), nats.ErrorHandler(asyncError))
 		if err != nil {
 			return nil, errors.New("No NATS")
 		}
-		return options, nil
 	}
-	return defaultOptions, nil
+	return options, nil
 }
 
-func close() {
+func disconnect() {
 	if nc != nil {
 		nc.Flush()
 		nc.Close()
@@ -97,6 +134,7 @@ func close() {
 
 // CloseAll closes everything
 func CloseAll() error {
+	subscriptionsLock.Lock()
 	keys := make([]string, len(subscriptions))
 
 	i := 0
@@ -104,6 +142,7 @@ func CloseAll() error {
 		keys[i] = k
 		i++
 	}
+	subscriptionsLock.Unlock()
 	for _, k := range keys {
 		err := Close(k)
 		if err != nil {
@@ -111,15 +150,19 @@ func CloseAll() error {
 		}
 
 	}
-	close()
+	DisableAdmin()
+	unsubscribeAll()
+	disconnect()
 	return nil
 }
 
 // Close reduces a topics servers to 0
 func Close(topic string) error {
-	if len(subscriptions) == 0 {
-		close()
+	subscriptionsLock.Lock()
+	defer subscriptionsLock.Unlock()
+	if len(subscriptions) == 0 && subscriberCount() == 0 {
+		disconnect()
 		return nil
 	}
-	return scaleDown(topic, Count(topic))
+	return scaleDown(topic, len(subscriptions[topic]))
 }
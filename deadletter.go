@@ -0,0 +1,168 @@
+package q
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const attemptHeader = "attempt"
+
+// DeadLetter is a message a server failed to handle, republished to its dead letter subject
+type DeadLetter struct {
+	ID       string    `json:"id"`
+	Subject  string    `json:"subject"`
+	Topic    string    `json:"topic"`
+	Message  []byte    `json:"message"` // The original message including its headers
+	Kind     string    `json:"kind"`    // error, panic or timeout
+	Error    string    `json:"error"`
+	ServerID string    `json:"serverId"`
+	TraceID  string    `json:"traceId"`
+	Attempt  int       `json:"attempt"`
+	Time     time.Time `json:"time"`
+}
+
+// DeadLetterSubject republishes the messages a server fails to handle, with the error, to subject
+func DeadLetterSubject(subject string) Option {
+	if !IsValidRequestName(subject) {
+		log.Fatal(fmt.Sprintf("DeadLetterSubject '%s' is not valid", subject))
+	}
+	return func(t *Options) {
+		t.deadLetter = subject
+	}
+}
+
+// deadLetter republishes the message of call to the server's dead letter subject
+func (s *server) deadLetter(call *invocation, err error) {
+	if s.options.deadLetter == "" || call == nil {
+		return
+	}
+	attempt, e := strconv.Atoi(call.headers[attemptHeader])
+	if e != nil {
+		attempt = 1
+	}
+	kind := "error"
+	if remote, ok := err.(*RemoteError); ok {
+		kind = remote.Kind
+	}
+	data, e := json.Marshal(DeadLetter{ID: NewID(), Subject: call.msg.Subject, Topic: s.topic, Message: call.msg.Data,
+		Kind: kind, Error: err.Error(), ServerID: s.id, TraceID: call.headers["traceId"], Attempt: attempt, Time: time.Now()})
+	if e != nil {
+		return
+	}
+	s.conn.Publish(s.options.deadLetter, buildMessage(call.headers["traceId"], data))
+}
+
+// DeadLetterQueue keeps the dead letters published to a subject so they can be browsed and re-driven
+type DeadLetterQueue struct {
+	subscription *Subscription
+	size         int
+	letters      []DeadLetter
+	lock         sync.Mutex
+}
+
+// OpenDeadLetters starts keeping up to size dead letters published to subject, the oldest are dropped first
+func OpenDeadLetters(subject string, size int) (*DeadLetterQueue, error) {
+	q := &DeadLetterQueue{size: size}
+	var err error
+	q.subscription, err = Subscribe(subject, q.receive)
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *DeadLetterQueue) receive(m *Message) {
+	var letter DeadLetter
+	if json.Unmarshal(m.Data, &letter) != nil {
+		return
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.letters = append(q.letters, letter)
+	if len(q.letters) > q.size {
+		q.letters = q.letters[len(q.letters)-q.size:]
+	}
+}
+
+// List returns the dead letters kept, oldest first
+func (q *DeadLetterQueue) List() []DeadLetter {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return append([]DeadLetter(nil), q.letters...)
+}
+
+// Remove drops the dead letter with id, returning false if it is not kept
+func (q *DeadLetterQueue) Remove(id string) bool {
+	_, ok := q.take(id)
+	return ok
+}
+
+// Redrive sends the dead letter with id to its original subject again as its next attempt and drops it
+func (q *DeadLetterQueue) Redrive(id string) error {
+	letter, ok := q.take(id)
+	if !ok {
+		return fmt.Errorf("dead letter '%s' was not found", id)
+	}
+	return redrive(letter)
+}
+
+// RedriveAll re-drives every dead letter kept, returning the number sent
+func (q *DeadLetterQueue) RedriveAll() (int, error) {
+	q.lock.Lock()
+	letters := q.letters
+	q.letters = nil
+	q.lock.Unlock()
+	for i, letter := range letters {
+		if err := redrive(letter); err != nil {
+			q.lock.Lock()
+			q.letters = append(letters[i:], q.letters...)
+			q.lock.Unlock()
+			return i, err
+		}
+	}
+	return len(letters), nil
+}
+
+// Close stops keeping dead letters
+func (q *DeadLetterQueue) Close() error {
+	return q.subscription.Unsubscribe()
+}
+
+// take removes and returns the dead letter with id
+func (q *DeadLetterQueue) take(id string) (DeadLetter, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for i, letter := range q.letters {
+		if letter.ID == id {
+			q.letters = append(q.letters[:i:i], q.letters[i+1:]...)
+			return letter, true
+		}
+	}
+	return DeadLetter{}, false
+}
+
+// redrive publishes the original message of letter with its attempt count increased and without a deadline
+func redrive(letter DeadLetter) error {
+	if nc == nil {
+		return errors.New("No NATS")
+	}
+	message := withHeader(letter.Message, Header{Key: attemptHeader, Value: strconv.Itoa(letter.Attempt + 1)})
+	return nc.Publish(letter.Subject, withHeader(message, Header{Key: deadlineHeader}))
+}
+
+// withHeader returns message with header added, replacing any header with the same key
+func withHeader(message []byte, header Header) []byte {
+	i := bytes.Index(message, []byte{'\n', '\n'})
+	if i < 0 {
+		return message
+	}
+	out := append([]byte(nil), message[:i]...)
+	out = append(out, "\n"+header.Key+":"+header.Value...)
+	return append(out, message[i:]...)
+}
@@ -0,0 +1,80 @@
+package q
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeadLetter(t *testing.T) {
+	letters, err := OpenDeadLetters("test.deadletter.letters", 10)
+	if err != nil {
+		t.Errorf("TestDeadLetter OpenDeadLetters got %s", err)
+	}
+	defer letters.Close()
+	var calls int32
+	svr, err := NewTopic("test.deadletter", func(svr Server, topic string, message []byte) ([]byte, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return nil, errors.New("oops")
+		}
+		return []byte("ok"), nil
+	}, DeadLetterSubject("test.deadletter.letters"))
+	if err != nil {
+		t.Errorf("TestDeadLetter NewTopic got %s", err)
+	}
+	defer svr.Close()
+	traceID := NewID()
+	if err = Send(traceID, "test.deadletter", []byte("order")); err != nil {
+		t.Errorf("TestDeadLetter Send got %s", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	list := letters.List()
+	if len(list) != 1 {
+		t.Errorf("TestDeadLetter expected 1 dead letter got %d", len(list))
+		return
+	}
+	l := list[0]
+	if l.Kind != "error" || l.Error != "oops" || l.ServerID != svr.ID() || l.TraceID != traceID || l.Attempt != 1 || l.Subject != "test.deadletter" {
+		t.Errorf("TestDeadLetter expected the failed request got %+v", l)
+	}
+	if _, body := ParseMessage(l.Message); string(body) != "order" {
+		t.Errorf("TestDeadLetter expected original message got %s", body)
+	}
+	if err = letters.Redrive(l.ID); err != nil {
+		t.Errorf("TestDeadLetter Redrive got %s", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&calls) != 2 || len(letters.List()) != 0 {
+		t.Errorf("TestDeadLetter expected re-driven message to be handled got calls %d letters %d", calls, len(letters.List()))
+	}
+	if err = letters.Redrive(l.ID); err == nil {
+		t.Error("TestDeadLetter expected re-driven letter to be gone")
+	}
+}
+
+func TestDeadLetterPanic(t *testing.T) {
+	letters, err := OpenDeadLetters("test.deadletter.panics", 10)
+	if err != nil {
+		t.Errorf("TestDeadLetterPanic OpenDeadLetters got %s", err)
+	}
+	defer letters.Close()
+	svr, err := NewTopic("test.deadletter.panic", Panicky, DeadLetterSubject("test.deadletter.panics"))
+	if err != nil {
+		t.Errorf("TestDeadLetterPanic NewTopic got %s", err)
+	}
+	defer svr.Close()
+	Request("", "test.deadletter.panic", []byte("panic"), time.Second)
+	time.Sleep(50 * time.Millisecond)
+	if list := letters.List(); len(list) != 1 || list[0].Kind != "panic" {
+		t.Errorf("TestDeadLetterPanic expected a panic dead letter got %+v", list)
+	}
+}
+
+func TestWithHeader(t *testing.T) {
+	message := withHeader(buildMessage("t", []byte("body"), Header{Key: attemptHeader, Value: "1"}), Header{Key: attemptHeader, Value: "2"})
+	headers, body := ParseMessage(message)
+	if headers[attemptHeader] != "2" || headers["traceId"] != "t" || string(body) != "body" {
+		t.Errorf("TestWithHeader expected attempt 2 got %q", message)
+	}
+}
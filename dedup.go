@@ -0,0 +1,130 @@
+package q
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const messageIDHeader = "msgId"
+const sequenceHeader = "seq"
+
+// MessageID returns a header identifying a message so a server using Dedup handles it only once
+func MessageID(id string) Header {
+	return Header{Key: messageIDHeader, Value: id}
+}
+
+// Sequence returns a header numbering a message within its trace, without a MessageID Dedup identifies a message
+// by its trace id and sequence
+func Sequence(n int) Header {
+	return Header{Key: sequenceHeader, Value: strconv.Itoa(n)}
+}
+
+// DedupStore keeps the replies to handled messages, a store shared between processes deduplicates across them
+type DedupStore interface {
+	Get(id string) ([]byte, bool)
+	Put(id string, reply []byte, window time.Duration)
+}
+
+// Deduplicate makes a server handle each message only once within window, see Dedup
+func Deduplicate(window time.Duration, store DedupStore) Option {
+	return Use(Dedup(window, store))
+}
+
+// Dedup returns middleware that replies to a duplicate of a message handled within window with the first reply
+// instead of handling it again.  Messages are identified by their MessageID header, or trace id and Sequence
+// header, messages with neither are always handled.  Errors are not kept so a retry is handled again.
+// store may be nil for an in-memory store of 10000 replies.
+func Dedup(window time.Duration, store DedupStore) Middleware {
+	if store == nil {
+		store = NewMemoryStore(10000)
+	}
+	return func(handler Handler) Handler {
+		return func(svr Server, topic string, message []byte) ([]byte, error) {
+			headers, _ := ParseMessage(message)
+			id := headers[messageIDHeader]
+			if id == "" && headers[sequenceHeader] != "" {
+				id = headers["traceId"] + "." + headers[sequenceHeader]
+			}
+			if id == "" {
+				return handler(svr, topic, message)
+			}
+			id = topic + "\n" + id
+			if reply, ok := store.Get(id); ok {
+				return reply, nil
+			}
+			ctx := context.Background()
+			if svr != nil {
+				ctx = svr.Context()
+			}
+			// Duplicates arriving while the first is being handled wait for its reply
+			return coalesce(ctx, "$Q.dedup\n"+id, func(shared context.Context) ([]byte, error) {
+				if reply, ok := store.Get(id); ok {
+					return reply, nil
+				}
+				reply, err := handler(withContext(svr, shared), topic, message)
+				if err == nil {
+					store.Put(id, reply, window)
+				}
+				return reply, err
+			})
+		}
+	}
+}
+
+// MemoryStore is a DedupStore for one process, the least recently used replies are evicted once it is full
+type MemoryStore struct {
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+	lock    sync.Mutex
+}
+
+type storeEntry struct {
+	id      string
+	reply   []byte
+	expires time.Time
+}
+
+// NewMemoryStore returns a store holding up to size replies
+func NewMemoryStore(size int) *MemoryStore {
+	return &MemoryStore{size: size, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// Get returns the reply kept for id if its window has not passed
+func (s *MemoryStore) Get(id string) ([]byte, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.entries[id]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*storeEntry)
+	if time.Now().After(entry.expires) {
+		s.order.Remove(e)
+		delete(s.entries, id)
+		return nil, false
+	}
+	s.order.MoveToFront(e)
+	return append([]byte(nil), entry.reply...), true
+}
+
+// Put keeps reply for id for window
+func (s *MemoryStore) Put(id string, reply []byte, window time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	entry := &storeEntry{id: id, reply: append([]byte(nil), reply...), expires: time.Now().Add(window)}
+	if e, ok := s.entries[id]; ok {
+		e.Value = entry
+		s.order.MoveToFront(e)
+	} else {
+		s.entries[id] = s.order.PushFront(entry)
+	}
+	for s.order.Len() > s.size {
+		last := s.order.Back()
+		s.order.Remove(last)
+		delete(s.entries, last.Value.(*storeEntry).id)
+	}
+}
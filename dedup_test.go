@@ -0,0 +1,96 @@
+package q
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Counting(count *int32) Handler {
+	return func(svr Server, topic string, message []byte) ([]byte, error) {
+		return []byte(fmt.Sprint(atomic.AddInt32(count, 1))), nil
+	}
+}
+
+func TestDedup(t *testing.T) {
+	var count int32
+	svr, err := NewTopic("test.dedup", Counting(&count), Deduplicate(time.Minute, nil))
+	if err != nil {
+		t.Errorf("TestDedup NewTopic got %s", err)
+	}
+	defer svr.Close()
+	for i := 0; i < 2; i++ {
+		reply, err := Request("", "test.dedup", []byte("x"), time.Second, MessageID("m1"))
+		if err != nil {
+			t.Errorf("TestDedup Request got %s", err)
+		}
+		if string(reply) != "1" {
+			t.Errorf("TestDedup expected first reply for duplicate got %s", reply)
+		}
+	}
+	traceID := NewID()
+	Request(traceID, "test.dedup", []byte("x"), time.Second, Sequence(1))
+	reply, _ := Request(traceID, "test.dedup", []byte("x"), time.Second, Sequence(1))
+	if string(reply) != "2" {
+		t.Errorf("TestDedup expected trace and sequence duplicate to get 2 got %s", reply)
+	}
+	if reply, _ = Request(traceID, "test.dedup", []byte("x"), time.Second, Sequence(2)); string(reply) != "3" {
+		t.Errorf("TestDedup expected next sequence to be handled got %s", reply)
+	}
+	if reply, _ = Request(traceID, "test.dedup", []byte("x"), time.Second); string(reply) != "4" {
+		t.Errorf("TestDedup expected message without id to be handled got %s", reply)
+	}
+}
+
+func TestDedupConcurrent(t *testing.T) {
+	var count int32
+	handler := Dedup(time.Minute, nil)(func(svr Server, topic string, message []byte) ([]byte, error) {
+		time.Sleep(20 * time.Millisecond)
+		return Counting(&count)(svr, topic, message)
+	})
+	message := buildMessage(NewID(), []byte("x"), MessageID("same"))
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler(nil, "test.dedup.concurrent", message)
+		}()
+	}
+	wg.Wait()
+	if count != 1 {
+		t.Errorf("TestDedupConcurrent expected 1 call got %d", count)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore(2)
+	store.Put("a", []byte("1"), time.Minute)
+	store.Put("b", []byte("2"), time.Millisecond)
+	store.Put("c", []byte("3"), time.Minute)
+	if _, ok := store.Get("a"); ok {
+		t.Error("TestMemoryStore expected a to be evicted")
+	}
+	time.Sleep(2 * time.Millisecond)
+	if _, ok := store.Get("b"); ok {
+		t.Error("TestMemoryStore expected b to have expired")
+	}
+	if reply, ok := store.Get("c"); !ok || string(reply) != "3" {
+		t.Errorf("TestMemoryStore expected 3 got %s", reply)
+	}
+}
+
+func TestDedupPanic(t *testing.T) {
+	svr, err := NewTopic("test.dedup.panic", Panicky, Deduplicate(time.Minute, nil))
+	if err != nil {
+		t.Errorf("TestDedupPanic NewTopic got %s", err)
+	}
+	defer svr.Close()
+	_, err = Request("", "test.dedup.panic", []byte("panic"), time.Second, MessageID("p1"))
+	if !errors.Is(err, ErrPanic) {
+		t.Errorf("TestDedupPanic expected ErrPanic got %v", err)
+	}
+}
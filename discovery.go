@@ -0,0 +1,225 @@
+package q
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const discoverySubject = "$Q.discovery"
+const discoveryQuerySubject = "$Q.discovery.query"
+
+// missedHeartbeats is how many heartbeats a process can miss before its servers expire
+const missedHeartbeats = 3
+
+// ServerEntry describes a server announced by a process
+type ServerEntry struct {
+	Topic      string    `json:"topic"`
+	Queue      string    `json:"queue,omitempty"`
+	Instances  []string  `json:"instances"`
+	AppName    string    `json:"appName"`
+	AppID      string    `json:"appId"`
+	AppVersion string    `json:"appVersion,omitempty"`
+	Host       string    `json:"host"`
+	LastSeen   time.Time `json:"-"`
+}
+
+type announcement struct {
+	AppName    string        `json:"appName"`
+	AppID      string        `json:"appId"`
+	AppVersion string        `json:"appVersion,omitempty"`
+	Host       string        `json:"host"`
+	Interval   time.Duration `json:"interval"`
+	Leaving    bool          `json:"leaving,omitempty"`
+	Servers    []ServerEntry `json:"servers"`
+}
+
+type process struct {
+	announcement
+	lastSeen time.Time
+}
+
+var announcing chan struct{}
+var announceInterval time.Duration
+var announceConn *nats.Conn
+var announceSub *nats.Subscription
+var processes = make(map[string]*process)
+var discoveryConn *nats.Conn
+var discoveryLock sync.Mutex
+
+// Announce announces this process's servers to other processes every interval until StopAnnouncing is called
+func Announce(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("announce interval must be >0")
+	}
+	if nc == nil {
+		if _, err := Open(); err != nil {
+			return err
+		}
+	}
+	discoveryLock.Lock()
+	if announcing != nil {
+		discoveryLock.Unlock()
+		return errors.New("already announcing")
+	}
+	announcing = make(chan struct{})
+	announceInterval = interval
+	stop := announcing
+	discoveryLock.Unlock()
+
+	announce(false)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				announce(false)
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// StopAnnouncing stops announcing and tells other processes this process's servers have gone
+func StopAnnouncing() {
+	discoveryLock.Lock()
+	if announcing == nil {
+		discoveryLock.Unlock()
+		return
+	}
+	close(announcing)
+	announcing = nil
+	announceInterval = 0
+	announceSub.Unsubscribe()
+	announceSub = nil
+	announceConn = nil
+	discoveryLock.Unlock()
+	announce(true)
+}
+
+// announce publishes this process's servers, answering queries on the current connection, it does nothing
+// but leave once StopAnnouncing has been called
+func announce(leaving bool) {
+	conn := nc
+	if conn == nil {
+		return
+	}
+	discoveryLock.Lock()
+	if announcing == nil && !leaving {
+		discoveryLock.Unlock()
+		return
+	}
+	interval := announceInterval
+	if announceConn != conn && !leaving {
+		if sub, err := conn.Subscribe(discoveryQuerySubject, func(m *nats.Msg) { announce(false) }); err == nil {
+			announceSub.Unsubscribe()
+			announceSub = sub
+			announceConn = conn
+		}
+	}
+	discoveryLock.Unlock()
+
+	host, _ := os.Hostname()
+	a := announcement{AppName: AppName(), AppID: AppID(), AppVersion: AppVersion(), Host: host, Interval: interval, Leaving: leaving}
+	if !leaving {
+		subscriptionsLock.Lock()
+		for topic, services := range subscriptions {
+			entry := ServerEntry{Topic: topic}
+			for _, s := range services {
+				entry.Queue = s.queue
+				entry.Instances = append(entry.Instances, s.id)
+			}
+			a.Servers = append(a.Servers, entry)
+		}
+		subscriptionsLock.Unlock()
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return
+	}
+	conn.Publish(discoverySubject, buildMessage(NewID(), data))
+}
+
+// watchAnnouncements records announcements received on the current connection
+func watchAnnouncements() error {
+	if nc == nil {
+		if _, err := Open(); err != nil {
+			return err
+		}
+	}
+	discoveryLock.Lock()
+	defer discoveryLock.Unlock()
+	if discoveryConn == nc {
+		return nil
+	}
+	_, err := nc.Subscribe(discoverySubject, func(m *nats.Msg) {
+		_, data := ParseMessage(m.Data)
+		var a announcement
+		if json.Unmarshal(data, &a) != nil {
+			return
+		}
+		discoveryLock.Lock()
+		defer discoveryLock.Unlock()
+		if a.Leaving {
+			delete(processes, a.AppID)
+		} else {
+			processes[a.AppID] = &process{announcement: a, lastSeen: time.Now()}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	discoveryConn = nc
+	return nil
+}
+
+// Discover asks every process to announce its servers, waits for their announcements and returns ListServers
+func Discover(wait time.Duration) ([]ServerEntry, error) {
+	if err := watchAnnouncements(); err != nil {
+		return nil, err
+	}
+	if err := nc.Publish(discoveryQuerySubject, buildMessage(NewID(), nil)); err != nil {
+		return nil, err
+	}
+	time.Sleep(wait)
+	return ListServers(), nil
+}
+
+// ListServers returns the servers of every live process seen since Discover was first called,
+// a process's servers expire when it misses several heartbeats
+func ListServers() []ServerEntry {
+	watchAnnouncements()
+	discoveryLock.Lock()
+	defer discoveryLock.Unlock()
+	now := time.Now()
+	var entries []ServerEntry
+	for id, p := range processes {
+		if p.Interval > 0 && now.Sub(p.lastSeen) > missedHeartbeats*p.Interval {
+			delete(processes, id)
+			continue
+		}
+		for _, s := range p.Servers {
+			s.AppName = p.AppName
+			s.AppID = p.AppID
+			s.AppVersion = p.AppVersion
+			s.Host = p.Host
+			s.LastSeen = p.lastSeen
+			entries = append(entries, s)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Topic != entries[j].Topic {
+			return entries[i].Topic < entries[j].Topic
+		}
+		return entries[i].AppID < entries[j].AppID
+	})
+	return entries
+}
@@ -0,0 +1,68 @@
+package q
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiscover(t *testing.T) {
+	svr, err := NewTopic("test.discover", SimpleServer)
+	if err != nil {
+		t.Errorf("TestDiscover NewTopic got %s", err)
+	}
+	defer svr.Close()
+	if err = Announce(time.Second); err != nil {
+		t.Errorf("TestDiscover Announce got %s", err)
+	}
+	entries, err := Discover(50 * time.Millisecond)
+	StopAnnouncing()
+	if err != nil {
+		t.Errorf("TestDiscover Discover got %s", err)
+	}
+	var found *ServerEntry
+	for i := range entries {
+		if entries[i].Topic == "test.discover" {
+			found = &entries[i]
+		}
+	}
+	if found == nil {
+		t.Errorf("TestDiscover expected test.discover got %v", entries)
+		return
+	}
+	if found.AppID != AppID() || len(found.Instances) != 1 || found.Instances[0] != svr.ID() {
+		t.Errorf("TestDiscover expected this instance got %+v", *found)
+	}
+	time.Sleep(50 * time.Millisecond)
+	for _, e := range ListServers() {
+		if e.AppID == AppID() {
+			t.Errorf("TestDiscover expected %s to have left got %+v", AppID(), e)
+		}
+	}
+	// A process that has stopped announcing does not answer queries
+	if entries, err = Discover(50 * time.Millisecond); err != nil {
+		t.Errorf("TestDiscover Discover got %s", err)
+	}
+	for _, e := range entries {
+		if e.AppID == AppID() {
+			t.Errorf("TestDiscover expected %s not to answer after leaving got %+v", AppID(), e)
+		}
+	}
+}
+
+func TestDiscoveryExpiry(t *testing.T) {
+	discoveryLock.Lock()
+	processes["expired"] = &process{announcement: announcement{AppID: "expired", Interval: time.Millisecond,
+		Servers: []ServerEntry{{Topic: "gone"}}}, lastSeen: time.Now().Add(-time.Second)}
+	discoveryLock.Unlock()
+	for _, e := range ListServers() {
+		if e.AppID == "expired" {
+			t.Error("TestDiscoveryExpiry expected expired entry to be removed")
+		}
+	}
+}
+
+func TestAnnounceInvalid(t *testing.T) {
+	if err := Announce(0); err == nil {
+		t.Error("TestAnnounceInvalid expected error for 0 interval")
+	}
+}
@@ -0,0 +1,58 @@
+package q
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+const errorKindHeader = "errorKind"
+
+// ErrPanic is matched by errors.Is when a server's handler panicked
+var ErrPanic = errors.New("handler panicked")
+
+// remoteErrors maps the kind of a RemoteError to the error it matches
+var remoteErrors = map[string]error{
+	"panic":      ErrPanic,
+	"timeout":    ErrHandlerTimeout,
+	"overloaded": ErrOverloaded,
+}
+
+// RemoteError is an error reported by a server, use errors.Is to check its kind
+type RemoteError struct {
+	Kind     string
+	Message  string
+	ServerID string
+	TraceID  string
+}
+
+func (e *RemoteError) Error() string {
+	return e.Kind + ": " + e.Message
+}
+
+// Is returns true if target is the error for e's kind
+func (e *RemoteError) Is(target error) bool {
+	err, ok := remoteErrors[e.Kind]
+	return ok && err == target
+}
+
+// errorReply returns the reply for an error returned by a handler
+func errorReply(err error) []byte {
+	e, ok := err.(*RemoteError)
+	if !ok {
+		return []byte(fmt.Sprintf("error:%s", err))
+	}
+	return append([]byte("error:"), ReplyWithHeaders([]byte(e.Message),
+		Header{Key: errorKindHeader, Value: e.Kind},
+		Header{Key: "serverId", Value: e.ServerID},
+		Header{Key: "traceId", Value: e.TraceID})...)
+}
+
+// parseError returns the error in an error reply, without its error: prefix
+func parseError(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(replyHeadersPrefix)) {
+		return errors.New(string(data))
+	}
+	headers, message := parseReply(data)
+	return &RemoteError{Kind: headers[errorKindHeader], Message: string(message), ServerID: headers["serverId"], TraceID: headers["traceId"]}
+}
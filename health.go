@@ -0,0 +1,125 @@
+package q
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// HealthCheckFunc checks the dependencies of a server, returning an error if they are unhealthy
+type HealthCheckFunc func() error
+
+// Health is a server instance's answer to a health request
+type Health struct {
+	ServerID    string        `json:"serverId"`
+	Topic       string        `json:"topic"`
+	Status      string        `json:"status"`
+	Uptime      time.Duration `json:"uptime"`
+	Instances   int           `json:"instances"`
+	LastError   string        `json:"lastError,omitempty"`
+	LastErrorAt time.Time     `json:"lastErrorAt,omitempty"`
+	Check       string        `json:"check,omitempty"`
+}
+
+// PingResult is one server instance's answer to Ping
+type PingResult struct {
+	Health
+	RTT time.Duration
+}
+
+// HealthCheck registers check to be run for each health request, a server is unhealthy when it returns an error
+func HealthCheck(check HealthCheckFunc) Option {
+	return func(t *Options) {
+		t.healthCheck = check
+	}
+}
+
+// healthSubject returns the subject health requests for name, a topic or instance id, are sent to
+func healthSubject(name string) string {
+	return "$Q.health." + name
+}
+
+// subscribeHealth answers health requests for the instance's topic and id
+func (s *server) subscribeHealth() error {
+	for _, name := range []string{s.topic, s.id} {
+		sub, err := s.conn.Subscribe(healthSubject(name), s.health)
+		if err != nil {
+			return err
+		}
+		s.healthsubs = append(s.healthsubs, sub)
+	}
+	return nil
+}
+
+// health replies to a health request with the instance's health
+func (s *server) health(m *nats.Msg) {
+	if m.Reply == "" {
+		return
+	}
+	h := Health{ServerID: s.id, Topic: s.topic, Status: "ok", Uptime: time.Since(s.started), Instances: Count(s.topic)}
+	s.lock.Lock()
+	h.LastError = s.lastError
+	h.LastErrorAt = s.lastErrorAt
+	s.lock.Unlock()
+	if s.options.healthCheck != nil {
+		if err := s.options.healthCheck(); err != nil {
+			h.Status = "unhealthy"
+			h.Check = err.Error()
+		}
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		return
+	}
+	s.conn.Publish(m.Reply, data)
+}
+
+// failed records err as the instance's last error and dead letters the message of call
+func (s *server) failed(call *invocation, err error) {
+	s.deadLetter(call, err)
+	s.lock.Lock()
+	s.errors++
+	s.lastError = err.Error()
+	s.lastErrorAt = time.Now()
+	s.lock.Unlock()
+}
+
+// Ping asks every instance of serverName, a topic or instance id, for its health and returns the answers
+// received within timeout along with their round trip times
+func Ping(serverName string, timeout time.Duration) ([]PingResult, error) {
+	if !IsValidRequestName((serverName)) {
+		return nil, fmt.Errorf("'%s' was not a valid request name", serverName)
+	}
+	if nc == nil {
+		if _, err := Open(); err != nil {
+			return nil, err
+		}
+	}
+	replies := make(chan *nats.Msg, 64)
+	sub, err := nc.ChanSubscribe(nats.NewInbox(), replies)
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+	start := time.Now()
+	if err = nc.PublishRequest(healthSubject(serverName), sub.Subject, nil); err != nil {
+		return nil, err
+	}
+
+	var results []PingResult
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case m := <-replies:
+			r := PingResult{RTT: time.Since(start)}
+			if json.Unmarshal(m.Data, &r.Health) == nil {
+				results = append(results, r)
+			}
+		case <-timer.C:
+			return results, nil
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package q
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPing(t *testing.T) {
+	svr, err := NewTopic("test.health.ping", SimpleServer, InitialScale(2))
+	if err != nil {
+		t.Errorf("TestPing NewTopic got %s", err)
+	}
+	defer svr.Close()
+	results, err := Ping("test.health.ping", 50*time.Millisecond)
+	if err != nil {
+		t.Errorf("TestPing Ping got %s", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("TestPing expected 2 answers got %d", len(results))
+	}
+	for _, r := range results {
+		if r.Status != "ok" || r.Instances != 2 || r.Topic != "test.health.ping" || r.RTT <= 0 {
+			t.Errorf("TestPing expected ok from 2 instances got %+v", r)
+		}
+	}
+	results, err = Ping(svr.ID(), 50*time.Millisecond)
+	if err != nil {
+		t.Errorf("TestPing Ping instance got %s", err)
+	}
+	if len(results) != 1 || results[0].ServerID != svr.ID() {
+		t.Errorf("TestPing expected only %s to answer got %+v", svr.ID(), results)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	svr, err := NewTopic("test.health.check", Bad, HealthCheck(func() error { return errors.New("database down") }))
+	if err != nil {
+		t.Errorf("TestHealthCheck NewTopic got %s", err)
+	}
+	defer svr.Close()
+	Request("", "test.health.check", []byte("x"), 100*time.Millisecond)
+	results, err := Ping("test.health.check", 50*time.Millisecond)
+	if err != nil {
+		t.Errorf("TestHealthCheck Ping got %s", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("TestHealthCheck expected 1 answer got %d", len(results))
+		return
+	}
+	r := results[0]
+	if r.Status != "unhealthy" || r.Check != "database down" {
+		t.Errorf("TestHealthCheck expected unhealthy from check got %+v", r)
+	}
+	if r.LastError == "" || r.LastErrorAt.IsZero() {
+		t.Errorf("TestHealthCheck expected last error to be recorded got %+v", r)
+	}
+}
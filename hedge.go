@@ -0,0 +1,175 @@
+package q
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+type hedge struct {
+	copies     int
+	delay      time.Duration
+	percentile float64
+}
+
+// Hedge sends up to copies requests to serverName, each one delay after the last if no reply has arrived,
+// returning the first successful reply.  Only use with idempotent servers, normally created with NewQueue.
+func Hedge(serverName string, copies int, delay time.Duration) Option {
+	return hedgeOption(serverName, hedge{copies: copies, delay: delay})
+}
+
+// HedgePercentile is Hedge with the delay taken from the observed latency percentile (0-100) of serverName,
+// initial is used as the delay until enough replies have been seen
+func HedgePercentile(serverName string, copies int, percentile float64, initial time.Duration) Option {
+	return hedgeOption(serverName, hedge{copies: copies, delay: initial, percentile: percentile})
+}
+
+func hedgeOption(serverName string, h hedge) Option {
+	if h.copies < 1 {
+		h.copies = 1
+	}
+	return func(t *Options) {
+		hedges := make(map[string]hedge)
+		for k, v := range t.hedges {
+			hedges[k] = v
+		}
+		hedges[serverName] = h
+		t.hedges = hedges
+	}
+}
+
+const latencySamples = 128
+const minLatencySamples = 16
+
+type latencies struct {
+	samples []time.Duration
+	next    int
+}
+
+var observed = make(map[string]*latencies)
+var observedLock sync.Mutex
+
+// observe records the latency of a successful reply from serverName
+func observe(serverName string, d time.Duration) {
+	observedLock.Lock()
+	defer observedLock.Unlock()
+	l, ok := observed[serverName]
+	if !ok {
+		l = &latencies{}
+		observed[serverName] = l
+	}
+	l.add(d)
+}
+
+// add records a latency, replacing the oldest once there are latencySamples
+func (l *latencies) add(d time.Duration) {
+	if len(l.samples) < latencySamples {
+		l.samples = append(l.samples, d)
+	} else {
+		l.samples[l.next] = d
+		l.next = (l.next + 1) % latencySamples
+	}
+}
+
+// LatencyPercentile returns the percentile (0-100) of recent reply latencies seen from a hedged serverName
+func LatencyPercentile(serverName string, percentile float64) time.Duration {
+	observedLock.Lock()
+	l, ok := observed[serverName]
+	if !ok {
+		observedLock.Unlock()
+		return 0
+	}
+	samples := append([]time.Duration(nil), l.samples...)
+	observedLock.Unlock()
+	return percentileOf(samples, percentile)
+}
+
+// percentileOf returns the percentile (0-100) of samples, sorting them
+func percentileOf(samples []time.Duration, percentile float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	i := int(percentile / 100 * float64(len(samples)-1))
+	if i < 0 {
+		i = 0
+	} else if i >= len(samples) {
+		i = len(samples) - 1
+	}
+	return samples[i]
+}
+
+// delayFor returns the time to wait before sending another copy to serverName
+func (h hedge) delayFor(serverName string) time.Duration {
+	if h.percentile <= 0 {
+		return h.delay
+	}
+	observedLock.Lock()
+	l, ok := observed[serverName]
+	enough := ok && len(l.samples) >= minLatencySamples
+	observedLock.Unlock()
+	if !enough {
+		return h.delay
+	}
+	return LatencyPercentile(serverName, h.percentile)
+}
+
+func isErrorReply(m *nats.Msg) bool {
+	return strings.HasPrefix(string(m.Data), "error:")
+}
+
+// hedgedRequest sends copies of data to serverName until one succeeds, cancelling the rest
+func hedgedRequest(ctx context.Context, serverName string, data []byte, h hedge) (*nats.Msg, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		msg *nats.Msg
+		err error
+	}
+	results := make(chan result, h.copies)
+	sent := 0
+	send := func() {
+		sent++
+		go func() {
+			start := time.Now()
+			m, err := nc.RequestWithContext(ctx, serverName, data)
+			if err == nil && !isErrorReply(m) {
+				observe(serverName, time.Since(start))
+			}
+			results <- result{m, err}
+		}()
+	}
+
+	delay := h.delayFor(serverName)
+	send()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var last result
+	for received := 0; received < sent; {
+		select {
+		case r := <-results:
+			received++
+			if r.err == nil && !isErrorReply(r.msg) {
+				return r.msg, nil
+			}
+			if last.msg == nil {
+				last = r
+			}
+			if received == sent && sent < h.copies && ctx.Err() == nil {
+				send()
+				timer.Reset(delay)
+			}
+		case <-timer.C:
+			if sent < h.copies {
+				send()
+				timer.Reset(delay)
+			}
+		}
+	}
+	return last.msg, last.err
+}
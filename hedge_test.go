@@ -0,0 +1,57 @@
+package q
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedge(t *testing.T) {
+	var calls int32
+	svr, err := NewQueue("test.hedge", "queue", func(svr Server, topic string, message []byte) ([]byte, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			time.Sleep(500 * time.Millisecond)
+			return []byte("slow"), nil
+		}
+		return []byte("fast"), nil
+	})
+	if err != nil {
+		t.Errorf("TestHedge NewQueue got %s", err)
+	}
+	defer svr.Close()
+	svr.Scale(9)
+	SetDefaultOptions(Hedge("test.hedge", 4, 20*time.Millisecond))
+	defer SetDefaultOptions()
+
+	start := time.Now()
+	reply, err := Request("hid", "test.hedge", []byte{}, time.Second)
+	if err != nil {
+		t.Errorf("TestHedge Request got %s", err)
+	}
+	if string(reply) != "fast" {
+		t.Errorf("TestHedge expected fast got %s", string(reply))
+	}
+	if time.Since(start) > 300*time.Millisecond {
+		t.Errorf("TestHedge expected hedged reply, took %s", time.Since(start))
+	}
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	delete(observed, "test.latency")
+	for i := 1; i <= 100; i++ {
+		observe("test.latency", time.Duration(i)*time.Millisecond)
+	}
+	if p := LatencyPercentile("test.latency", 50); p < 49*time.Millisecond || p > 51*time.Millisecond {
+		t.Errorf("Expected p50 of 50ms got %s", p)
+	}
+	if p := LatencyPercentile("test.latency", 99); p < 98*time.Millisecond {
+		t.Errorf("Expected p99 of 99ms got %s", p)
+	}
+	h := hedge{copies: 2, delay: time.Second, percentile: 90}
+	if d := h.delayFor("test.latency"); d > 95*time.Millisecond {
+		t.Errorf("Expected delay from p90 got %s", d)
+	}
+	if d := h.delayFor("test.latency.none"); d != time.Second {
+		t.Errorf("Expected initial delay without samples got %s", d)
+	}
+}
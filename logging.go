@@ -0,0 +1,57 @@
+package q
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// LogLevel is the minimum severity of the messages the package logs
+type LogLevel int32
+
+// Log levels, from most to least verbose
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+func (l LogLevel) String() string {
+	if l < LogDebug || l > LogError {
+		return fmt.Sprintf("LogLevel(%d)", int32(l))
+	}
+	return logLevelNames[l]
+}
+
+// ParseLogLevel returns the level named name, one of debug, info, warn or error
+func ParseLogLevel(name string) (LogLevel, error) {
+	for i, n := range logLevelNames {
+		if strings.EqualFold(n, name) {
+			return LogLevel(i), nil
+		}
+	}
+	return LogInfo, fmt.Errorf("log level '%s' is not valid", name)
+}
+
+var logLevel int32 = int32(LogInfo)
+
+// SetLogLevel sets the minimum level of messages the package logs, default is LogInfo
+func SetLogLevel(level LogLevel) {
+	atomic.StoreInt32(&logLevel, int32(level))
+}
+
+// GetLogLevel returns the minimum level of messages the package logs
+func GetLogLevel() LogLevel {
+	return LogLevel(atomic.LoadInt32(&logLevel))
+}
+
+// logf logs a message if level is at least the current log level
+func logf(level LogLevel, format string, args ...interface{}) {
+	if level >= GetLogLevel() {
+		log.Printf(format, args...)
+	}
+}
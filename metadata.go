@@ -0,0 +1,120 @@
+package q
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// EndpointSchema describes the request and response messages of an endpoint, e.g. as JSON schemas
+type EndpointSchema struct {
+	Request  string `json:"request,omitempty"`
+	Response string `json:"response,omitempty"`
+}
+
+// ServerDescription is a server instance's answer to Describe
+type ServerDescription struct {
+	Topic       string                    `json:"topic"`
+	Queue       string                    `json:"queue,omitempty"`
+	Version     string                    `json:"version,omitempty"`
+	Description string                    `json:"description,omitempty"`
+	Owner       string                    `json:"owner,omitempty"`
+	Endpoints   map[string]EndpointSchema `json:"endpoints,omitempty"`
+	ServerID    string                    `json:"serverId"`
+	AppName     string                    `json:"appName"`
+	AppID       string                    `json:"appId"`
+	Host        string                    `json:"host"`
+}
+
+// Version sets the version of a server
+func Version(version string) Option {
+	return func(t *Options) {
+		t.version = version
+	}
+}
+
+// Description sets what a server does
+func Description(description string) Option {
+	return func(t *Options) {
+		t.description = description
+	}
+}
+
+// Owner sets who is responsible for a server
+func Owner(owner string) Option {
+	return func(t *Options) {
+		t.owner = owner
+	}
+}
+
+// Endpoint sets the request and response schemas of subject, the server's topic or a subject it matches
+func Endpoint(subject, request, response string) Option {
+	return func(t *Options) {
+		endpoints := make(map[string]EndpointSchema)
+		for k, v := range t.endpoints {
+			endpoints[k] = v
+		}
+		endpoints[subject] = EndpointSchema{Request: request, Response: response}
+		t.endpoints = endpoints
+	}
+}
+
+// describeSubject returns the subject descriptions of topic are requested on
+func describeSubject(topic string) string {
+	return "$Q.describe." + topic
+}
+
+// describe replies to a describe request with the instance's description
+func (s *server) describe(m *nats.Msg) {
+	if m.Reply == "" {
+		return
+	}
+	host, _ := os.Hostname()
+	data, err := json.Marshal(ServerDescription{Topic: s.topic, Queue: s.queue, Version: s.options.version,
+		Description: s.options.description, Owner: s.options.owner, Endpoints: s.options.endpoints,
+		ServerID: s.id, AppName: AppName(), AppID: AppID(), Host: host})
+	if err != nil {
+		return
+	}
+	s.conn.Publish(m.Reply, data)
+}
+
+// Describe asks every instance serving topic what it does and returns the descriptions received within timeout,
+// the versions that are live are those of the descriptions
+func Describe(topic string, timeout time.Duration) ([]ServerDescription, error) {
+	if !IsValidServerName(topic) {
+		return nil, fmt.Errorf("'%s' was not a valid topic", topic)
+	}
+	if nc == nil {
+		if _, err := Open(); err != nil {
+			return nil, err
+		}
+	}
+	replies := make(chan *nats.Msg, 64)
+	sub, err := nc.ChanSubscribe(nats.NewInbox(), replies)
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+	if err = nc.PublishRequest(describeSubject(topic), sub.Subject, nil); err != nil {
+		return nil, err
+	}
+
+	var descriptions []ServerDescription
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case m := <-replies:
+			var d ServerDescription
+			if json.Unmarshal(m.Data, &d) == nil {
+				descriptions = append(descriptions, d)
+			}
+		case <-timer.C:
+			return descriptions, nil
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package q
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDescribe(t *testing.T) {
+	svr, err := NewTopic("test.orders.*", SimpleServer, Version("1.2.0"), Description("Order management"), Owner("orders team"),
+		Endpoint("test.orders.create", `{"type":"object"}`, `{"type":"string"}`))
+	if err != nil {
+		t.Errorf("TestDescribe NewTopic got %s", err)
+	}
+	defer svr.Close()
+	descriptions, err := Describe("test.orders.create", 50*time.Millisecond)
+	if err != nil {
+		t.Errorf("TestDescribe Describe got %s", err)
+	}
+	if len(descriptions) != 1 {
+		t.Errorf("TestDescribe expected 1 description got %d", len(descriptions))
+		return
+	}
+	d := descriptions[0]
+	if d.Topic != "test.orders.*" || d.Version != "1.2.0" || d.Owner != "orders team" || d.ServerID != svr.ID() || d.AppID != AppID() {
+		t.Errorf("TestDescribe expected the server's description got %+v", d)
+	}
+	if d.Endpoints["test.orders.create"].Request != `{"type":"object"}` {
+		t.Errorf("TestDescribe expected test.orders.create schema got %+v", d.Endpoints)
+	}
+	if descriptions, _ = Describe("test.inventory.list", 50*time.Millisecond); len(descriptions) != 0 {
+		t.Errorf("TestDescribe expected no descriptions got %+v", descriptions)
+	}
+}
@@ -0,0 +1,22 @@
+package q
+
+// Middleware wraps a Handler to add behaviour such as logging, authentication or metrics
+type Middleware func(Handler) Handler
+
+// Chain combines middleware into one, the first middleware is the outermost and sees each request first
+func Chain(middleware ...Middleware) Middleware {
+	return func(handler Handler) Handler {
+		for i := len(middleware) - 1; i >= 0; i-- {
+			handler = middleware[i](handler)
+		}
+		return handler
+	}
+}
+
+// Use wraps the handler of every instance of a server with middleware, middleware set with SetDefaultOptions
+// wraps the middleware set when the server is created
+func Use(middleware ...Middleware) Option {
+	return func(t *Options) {
+		t.middleware = append(append([]Middleware(nil), t.middleware...), middleware...)
+	}
+}
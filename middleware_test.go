@@ -0,0 +1,44 @@
+package q
+
+import (
+	"testing"
+	"time"
+)
+
+func Tag(tag string) Middleware {
+	return func(handler Handler) Handler {
+		return func(svr Server, topic string, message []byte) ([]byte, error) {
+			reply, err := handler(svr, topic, message)
+			return append([]byte(tag), reply...), err
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	reply, _ := Chain(Tag("a"), Tag("b"))(SimpleServer)(nil, "", nil)
+	if string(reply) != "abHello" {
+		t.Errorf("Expected abHello got %s", string(reply))
+	}
+	reply, _ = Chain()(SimpleServer)(nil, "", nil)
+	if string(reply) != "Hello" {
+		t.Errorf("Expected Hello got %s", string(reply))
+	}
+}
+
+func TestUse(t *testing.T) {
+	SetDefaultOptions(Use(Tag("default.")))
+	defer SetDefaultOptions()
+	svr, err := NewQueue("test.use", "queue", SimpleServer, Use(Tag("a."), Tag("b.")))
+	if err != nil {
+		t.Errorf("TestUse NewQueue got %s", err)
+	}
+	defer svr.Close()
+	svr.Scale(2)
+
+	for i := 0; i < 6; i++ {
+		reply, err := Request("", "test.use", []byte{}, 100*time.Millisecond)
+		if err != nil || string(reply) != "default.a.b.Hello" {
+			t.Errorf("TestUse expected default.a.b.Hello got %s, %v", string(reply), err)
+		}
+	}
+}
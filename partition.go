@@ -0,0 +1,186 @@
+package q
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const partitionKeyHeader = "partitionKey"
+
+// PartitionKey returns a header that routes a message to a partitioned server's instance for key
+func PartitionKey(key string) Header {
+	return Header{Key: partitionKeyHeader, Value: key}
+}
+
+// Partitioned makes a server's instances partitions, each handling its messages one at a time with up to queue
+// waiting.  Messages with the same PartitionKey header go to the same instance so they are handled in order, while
+// different keys are handled in parallel.  When the server is scaled keys move to balance the instances, a key
+// stays on its instance until the messages it already has are handled.  Messages without a key are spread by
+// trace id.  Order is kept within a process, Workers is ignored.
+func Partitioned(queue int) Option {
+	if queue < 0 {
+		log.Fatal(fmt.Sprintf("Partitioned queue '%d' is not valid, must be >=0", queue))
+	}
+	return func(t *Options) {
+		t.partitioned = true
+		t.partitionQueue = queue
+	}
+}
+
+// keyOwner is the instance a key's messages are routed to while it has some
+type keyOwner struct {
+	server  *server
+	pending int
+}
+
+var partitionKeys = make(map[string]map[string]*keyOwner)
+var partitionLock sync.Mutex
+
+// startPartition starts the instance handling the messages routed to it.  Once the instance is removed it keeps
+// handling the messages of the keys it owns, so they stay in order, and stops when there are none left.
+func (s *server) startPartition(queue int) {
+	s.jobs = make(chan job, queue)
+	s.quit = make(chan struct{})
+	go func() {
+		for {
+			select {
+			case j := <-s.jobs:
+				s.servePartition(j)
+			case <-s.quit:
+				for s.owns() {
+					s.servePartition(<-s.jobs)
+				}
+				return
+			}
+		}
+	}()
+}
+
+// servePartition handles j and records that its key has one less message
+func (s *server) servePartition(j job) {
+	s.serve(j)
+	partitionDone(s, partitionKey(j.msg))
+}
+
+// owns returns true if messages have been routed to the instance that it has not handled
+func (s *server) owns() bool {
+	partitionLock.Lock()
+	defer partitionLock.Unlock()
+	return s.owned > 0
+}
+
+// partitionKey returns the key m is routed by
+func partitionKey(m *nats.Msg) string {
+	headers, _ := ParseMessage(m.Data)
+	if key := headers[partitionKeyHeader]; key != "" {
+		return key
+	}
+	return headers["traceId"]
+}
+
+// route passes j to the instance of the server that owns its key
+func (s *server) route(j job) {
+	key := partitionKey(j.msg)
+	subscriptionsLock.Lock()
+	services := append([]*server(nil), subscriptions[s.topic]...)
+	subscriptionsLock.Unlock()
+	if len(services) == 0 {
+		s.release()
+		return
+	}
+
+	partitionLock.Lock()
+	keys, ok := partitionKeys[s.topic]
+	if !ok {
+		keys = make(map[string]*keyOwner)
+		partitionKeys[s.topic] = keys
+	}
+	// A key stays with its instance, even one that has been removed, until its messages are handled
+	owner, ok := keys[key]
+	if !ok {
+		target := rendezvous(services, key)
+		if target == nil {
+			partitionLock.Unlock()
+			s.release()
+			return
+		}
+		owner = &keyOwner{server: target}
+		keys[key] = owner
+	}
+	owner.pending++
+	owner.server.owned++
+	partitionLock.Unlock()
+
+	owner.server.jobs <- j
+}
+
+// partitionDone records that s has handled a message for key
+func partitionDone(s *server, key string) {
+	partitionLock.Lock()
+	defer partitionLock.Unlock()
+	s.owned--
+	keys := partitionKeys[s.topic]
+	owner, ok := keys[key]
+	if !ok {
+		return
+	}
+	owner.pending--
+	if owner.pending <= 0 {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(partitionKeys, s.topic)
+		}
+	}
+}
+
+// retire stops new keys being routed to the instance and tells it to stop once its keys' messages are handled
+func (s *server) retire() {
+	partitionLock.Lock()
+	s.retired = true
+	partitionLock.Unlock()
+	close(s.quit)
+}
+
+// rendezvous returns the instance with the highest hash for key, so few keys move when instances come and go,
+// partitionLock must be held
+func rendezvous(services []*server, key string) *server {
+	var best *server
+	var bestHash uint64
+	for _, s := range services {
+		if s.retired {
+			continue
+		}
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte{'\n'})
+		h.Write([]byte(s.id))
+		if sum := h.Sum64(); best == nil || sum > bestHash {
+			best, bestHash = s, sum
+		}
+	}
+	return best
+}
+
+// rebalance makes sure the first instance of a partitioned server receives its messages, subscriptionsLock must be held
+func rebalance(topic string) error {
+	services := subscriptions[topic]
+	if len(services) == 0 || !services[0].options.partitioned {
+		return nil
+	}
+	first := services[0]
+	first.lock.Lock()
+	subscribed := first.subscription != nil
+	first.lock.Unlock()
+	if subscribed || first.paused {
+		return nil
+	}
+	if err := first.subscribe(); err != nil {
+		logf(LogError, "partitioned server %s could not subscribe: %s", topic, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package q
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type handled struct {
+	lock    sync.Mutex
+	order   map[string][]int
+	servers map[string]map[string]bool
+}
+
+func (h *handled) handler(delay time.Duration) Handler {
+	return func(svr Server, topic string, message []byte) ([]byte, error) {
+		headers, body := ParseMessage(message)
+		time.Sleep(delay)
+		seq, _ := strconv.Atoi(string(body))
+		key := headers[partitionKeyHeader]
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		h.order[key] = append(h.order[key], seq)
+		if h.servers[key] == nil {
+			h.servers[key] = make(map[string]bool)
+		}
+		h.servers[key][svr.ID()] = true
+		return []byte("ok"), nil
+	}
+}
+
+func (h *handled) check(t *testing.T, keys, messages int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for k := 0; k < keys; k++ {
+		key := fmt.Sprint("key", k)
+		if len(h.order[key]) != messages {
+			t.Errorf("Expected %d messages for %s, got %v", messages, key, h.order[key])
+		}
+		for i, seq := range h.order[key] {
+			if seq != i {
+				t.Errorf("Expected %s in order, got %v", key, h.order[key])
+				break
+			}
+		}
+	}
+}
+
+func TestPartitioned(t *testing.T) {
+	h := &handled{order: make(map[string][]int), servers: make(map[string]map[string]bool)}
+	svr, err := NewQueue("test.partition.ordered", "queue", h.handler(time.Millisecond), Partitioned(100), InitialScale(3))
+	if err != nil {
+		t.Errorf("TestPartitioned NewQueue got %s", err)
+	}
+	defer svr.Close()
+	for i := 0; i < 10; i++ {
+		for k := 0; k < 5; k++ {
+			Send("", "test.partition.ordered", []byte(strconv.Itoa(i)), PartitionKey(fmt.Sprint("key", k)))
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+	h.check(t, 5, 10)
+	for key, servers := range h.servers {
+		if len(servers) != 1 {
+			t.Errorf("TestPartitioned expected %s on one instance got %v", key, servers)
+		}
+	}
+}
+
+func TestPartitionedParallel(t *testing.T) {
+	svr, err := NewTopic("test.partition.parallel", Sleepy, Partitioned(10), InitialScale(3))
+	if err != nil {
+		t.Errorf("TestPartitionedParallel NewTopic got %s", err)
+	}
+	defer svr.Close()
+	// Find a key for each instance
+	subscriptionsLock.Lock()
+	services := append([]*server(nil), subscriptions["test.partition.parallel"]...)
+	subscriptionsLock.Unlock()
+	keys := make(map[*server]string)
+	for i := 0; len(keys) < len(services); i++ {
+		key := fmt.Sprint("key", i)
+		partitionLock.Lock()
+		s := rendezvous(services, key)
+		partitionLock.Unlock()
+		if keys[s] == "" {
+			keys[s] = key
+		}
+	}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			if _, err := Request("", "test.partition.parallel", []byte("x"), time.Second, PartitionKey(key)); err != nil {
+				t.Errorf("TestPartitionedParallel Request got %s", err)
+			}
+		}(key)
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed > 120*time.Millisecond {
+		t.Errorf("TestPartitionedParallel expected keys on different instances to run in parallel got %s", elapsed)
+	}
+}
+
+func TestPartitionedRebalance(t *testing.T) {
+	h := &handled{order: make(map[string][]int), servers: make(map[string]map[string]bool)}
+	svr, err := NewTopic("test.partition.rebalance", h.handler(5*time.Millisecond), Partitioned(100))
+	if err != nil {
+		t.Errorf("TestPartitionedRebalance NewTopic got %s", err)
+	}
+	defer svr.Close()
+	for i := 0; i < 10; i++ {
+		Send("", "test.partition.rebalance", []byte(strconv.Itoa(i)), PartitionKey("key0"))
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err = svr.Scale(4); err != nil {
+		t.Errorf("TestPartitionedRebalance Scale got %s", err)
+	}
+	for i := 10; i < 20; i++ {
+		Send("", "test.partition.rebalance", []byte(strconv.Itoa(i)), PartitionKey("key0"))
+	}
+	time.Sleep(300 * time.Millisecond)
+	h.check(t, 1, 20)
+	if svr.Count() != 5 {
+		t.Errorf("TestPartitionedRebalance expected 5 instances got %d", svr.Count())
+	}
+}
+
+func TestPartitionedCloseFirst(t *testing.T) {
+	svr, err := NewTopic("test.partition.closefirst", SimpleServer, Partitioned(10), InitialScale(2))
+	if err != nil {
+		t.Errorf("TestPartitionedCloseFirst NewTopic got %s", err)
+	}
+	defer svr.Close()
+	subscriptionsLock.Lock()
+	first := subscriptions["test.partition.closefirst"][0]
+	subscriptionsLock.Unlock()
+	removeInstance(first)
+	if _, err = Request("", "test.partition.closefirst", []byte("x"), time.Second, PartitionKey("a")); err != nil {
+		t.Errorf("TestPartitionedCloseFirst expected the remaining instance to take over got %s", err)
+	}
+}
+
+func TestPartitionedScaleDown(t *testing.T) {
+	h := &handled{order: make(map[string][]int), servers: make(map[string]map[string]bool)}
+	svr, err := NewTopic("test.partition.scaledown", h.handler(2*time.Millisecond), Partitioned(100), InitialScale(4))
+	if err != nil {
+		t.Errorf("TestPartitionedScaleDown NewTopic got %s", err)
+	}
+	defer svr.Close()
+	for i := 0; i < 4; i++ {
+		for k := 0; k < 10; k++ {
+			Send("", "test.partition.scaledown", []byte(strconv.Itoa(i)), PartitionKey(fmt.Sprint("key", k)))
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err = svr.Scale(-3); err != nil {
+		t.Errorf("TestPartitionedScaleDown Scale got %s", err)
+	}
+	for k := 0; k < 10; k++ {
+		Send("", "test.partition.scaledown", []byte("4"), PartitionKey(fmt.Sprint("key", k)))
+	}
+	time.Sleep(300 * time.Millisecond)
+	h.check(t, 10, 5)
+}
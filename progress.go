@@ -0,0 +1,101 @@
+package q
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const progressHeader = "progress"
+
+// ProgressFunc is called with each progress update a server's handler sends with ReportProgress
+type ProgressFunc func(percent int, message string)
+
+// ReportProgress sends a progress update to the requester if it was made with RequestProgress, otherwise it does nothing
+func ReportProgress(svr Server, percent int, message string) error {
+	call, ok := svr.(*invocation)
+	if !ok || call.headers[progressHeader] == "" || call.msg.Reply == "" {
+		return nil
+	}
+	return call.conn.Publish(call.msg.Reply, ReplyWithHeaders([]byte(message), Header{Key: progressHeader, Value: strconv.Itoa(percent)}))
+}
+
+// RequestProgress sends a request to serverName and returns the reply, calling progress for each update the handler
+// sends with ReportProgress.  The request times out when idle passes without an update or the reply.
+func RequestProgress(ctx context.Context, traceID, serverName string, message []byte, idle time.Duration, progress ProgressFunc, headers ...Header) ([]byte, error) {
+	if !IsValidRequestName((serverName)) {
+		return nil, fmt.Errorf("'%s' was not a valid request name", serverName)
+	}
+	if nc == nil {
+		Open()
+	}
+	if traceID == "" {
+		traceID = NewID()
+	}
+	if err := waitRateLimit(ctx, serverName, defaultOptions); err != nil {
+		return nil, err
+	}
+	// Updates are queued without limit so a slow progress func cannot make the subscription drop the reply
+	var lock sync.Mutex
+	var replies []*nats.Msg
+	ready := make(chan struct{}, 1)
+	sub, err := nc.Subscribe(nats.NewInbox(), func(m *nats.Msg) {
+		lock.Lock()
+		replies = append(replies, m)
+		lock.Unlock()
+		select {
+		case ready <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+	headers, requestID := withRequestID(deadline(ctx, headers))
+	headers = append(headers, Header{Key: progressHeader, Value: "true"})
+	if err = nc.PublishRequest(serverName, sub.Subject, buildMessage(traceID, message, headers...)); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(idle)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ready:
+			lock.Lock()
+			received := replies
+			replies = nil
+			lock.Unlock()
+			for _, m := range received {
+				if strings.HasPrefix(string(m.Data), "error:") {
+					return nil, parseError(m.Data[6:])
+				}
+				replyHeaders, data := parseReply(m.Data)
+				percent, ok := replyHeaders[progressHeader]
+				if !ok {
+					return data, nil
+				}
+				if progress != nil {
+					p, _ := strconv.Atoi(percent)
+					progress(p, string(data))
+				}
+			}
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(idle)
+		case <-timer.C:
+			cancelRequest(traceID, requestID, serverName)
+			return nil, nats.ErrTimeout
+		case <-ctx.Done():
+			cancelRequest(traceID, requestID, serverName)
+			return nil, ctx.Err()
+		}
+	}
+}
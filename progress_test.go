@@ -0,0 +1,97 @@
+package q
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+func Slow(svr Server, topic string, message []byte) ([]byte, error) {
+	for i := 1; i <= 4; i++ {
+		time.Sleep(30 * time.Millisecond)
+		ReportProgress(svr, i*25, "working")
+	}
+	return []byte("done"), nil
+}
+
+func TestProgress(t *testing.T) {
+	svr, err := NewTopic("test.progress", Slow)
+	if err != nil {
+		t.Errorf("TestProgress NewTopic got %s", err)
+	}
+	defer svr.Close()
+
+	var updates []int
+	reply, err := RequestProgress(context.Background(), "", "test.progress", []byte{}, 50*time.Millisecond, func(percent int, message string) {
+		if message != "working" {
+			t.Errorf("TestProgress expected working got %s", message)
+		}
+		updates = append(updates, percent)
+	})
+	if err != nil {
+		t.Errorf("TestProgress RequestProgress got %s", err)
+	}
+	if string(reply) != "done" {
+		t.Errorf("TestProgress expected done got %s", string(reply))
+	}
+	if len(updates) != 4 || updates[3] != 100 {
+		t.Errorf("TestProgress expected 4 updates ending at 100 got %v", updates)
+	}
+}
+
+func TestProgressIdle(t *testing.T) {
+	svr, err := NewTopic("test.progress.idle", func(svr Server, topic string, message []byte) ([]byte, error) {
+		time.Sleep(100 * time.Millisecond)
+		return []byte("late"), nil
+	})
+	if err != nil {
+		t.Errorf("TestProgressIdle NewTopic got %s", err)
+	}
+	defer svr.Close()
+
+	_, err = RequestProgress(context.Background(), "", "test.progress.idle", []byte{}, 30*time.Millisecond, nil)
+	if err != nats.ErrTimeout {
+		t.Errorf("TestProgressIdle expected timeout got %v", err)
+	}
+}
+
+func TestProgressIgnored(t *testing.T) {
+	svr, err := NewTopic("test.progress.ignored", Slow)
+	if err != nil {
+		t.Errorf("TestProgressIgnored NewTopic got %s", err)
+	}
+	defer svr.Close()
+
+	reply, err := Request("", "test.progress.ignored", []byte{}, time.Second)
+	if err != nil || string(reply) != "done" {
+		t.Errorf("TestProgressIgnored expected done got %s, %v", string(reply), err)
+	}
+}
+
+func TestProgressBurst(t *testing.T) {
+	svr, err := NewTopic("test.progress.burst", func(svr Server, topic string, message []byte) ([]byte, error) {
+		for i := 0; i < 200; i++ {
+			ReportProgress(svr, i/2, "working")
+		}
+		return []byte("done"), nil
+	})
+	if err != nil {
+		t.Errorf("TestProgressBurst NewTopic got %s", err)
+	}
+	defer svr.Close()
+
+	// Updates arriving faster than progress handles them are not dropped
+	updates := 0
+	reply, err := RequestProgress(context.Background(), "", "test.progress.burst", []byte{}, time.Second, func(percent int, message string) {
+		time.Sleep(time.Millisecond)
+		updates++
+	})
+	if err != nil || string(reply) != "done" {
+		t.Errorf("TestProgressBurst expected done got %s, %v", string(reply), err)
+	}
+	if updates != 200 {
+		t.Errorf("TestProgressBurst expected 200 updates got %d", updates)
+	}
+}
@@ -0,0 +1,160 @@
+package q
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned by Send and Request when a rate limit is reached and RateLimitFailFast is set
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimitStat counts the calls to a server name affected by rate limiting
+type RateLimitStat struct {
+	Allowed   int64         // Calls let through without waiting
+	Throttled int64         // Calls that waited for a token
+	Rejected  int64         // Calls refused by RateLimitFailFast or a cancelled context
+	Waited    time.Duration // Total time spent waiting for tokens
+}
+
+type rateLimit struct {
+	perSecond float64
+	burst     int
+}
+
+// RateLimit limits the total rate of Send and Request calls to perSecond, allowing bursts of up to burst
+func RateLimit(perSecond float64, burst int) Option {
+	return RateLimitServer("", perSecond, burst)
+}
+
+// RateLimitServer limits the rate of Send and Request calls to serverName to perSecond, allowing bursts of up to burst
+func RateLimitServer(serverName string, perSecond float64, burst int) Option {
+	if burst < 1 {
+		burst = 1
+	}
+	return func(t *Options) {
+		limits := make(map[string]rateLimit)
+		for k, v := range t.rateLimits {
+			limits[k] = v
+		}
+		limits[serverName] = rateLimit{perSecond: perSecond, burst: burst}
+		t.rateLimits = limits
+	}
+}
+
+// RateLimitFailFast returns ErrRateLimited instead of waiting for the rate limit to allow a call
+func RateLimitFailFast() Option {
+	return func(t *Options) {
+		t.rateLimitFailFast = true
+	}
+}
+
+type bucket struct {
+	limit  rateLimit
+	tokens float64
+	last   time.Time
+}
+
+var buckets = make(map[string]*bucket)
+var rateLimitStats = make(map[string]*RateLimitStat)
+var rateLimitLock sync.Mutex
+
+// RateLimitStats returns the rate limiting counts for each server name called
+func RateLimitStats() map[string]RateLimitStat {
+	rateLimitLock.Lock()
+	defer rateLimitLock.Unlock()
+	stats := make(map[string]RateLimitStat)
+	for k, v := range rateLimitStats {
+		stats[k] = *v
+	}
+	return stats
+}
+
+// refill adds the tokens earned since the bucket was last used
+func (b *bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.perSecond
+	if b.tokens > float64(b.limit.burst) {
+		b.tokens = float64(b.limit.burst)
+	}
+	b.last = now
+}
+
+// delay returns how long until the bucket has a token
+func (b *bucket) delay() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	if b.limit.perSecond <= 0 {
+		return time.Duration(1<<63 - 1)
+	}
+	return time.Duration((1 - b.tokens) / b.limit.perSecond * float64(time.Second))
+}
+
+// waitRateLimit takes a token from the global and serverName buckets, waiting for them if needed
+func waitRateLimit(ctx context.Context, serverName string, options *Options) error {
+	if len(options.rateLimits) == 0 {
+		return nil
+	}
+	rateLimitLock.Lock()
+	stat, ok := rateLimitStats[serverName]
+	if !ok {
+		stat = &RateLimitStat{}
+		rateLimitStats[serverName] = stat
+	}
+	now := time.Now()
+	var taken []*bucket
+	var wait time.Duration
+	for _, name := range []string{"", serverName} {
+		limit, ok := options.rateLimits[name]
+		if !ok {
+			continue
+		}
+		b, ok := buckets[name]
+		if !ok || b.limit != limit {
+			b = &bucket{limit: limit, tokens: float64(limit.burst), last: now}
+			buckets[name] = b
+		}
+		b.refill(now)
+		if d := b.delay(); d > wait {
+			wait = d
+		}
+		taken = append(taken, b)
+		if name == "" && serverName == "" {
+			break
+		}
+	}
+	if wait > 0 && options.rateLimitFailFast {
+		stat.Rejected++
+		rateLimitLock.Unlock()
+		return ErrRateLimited
+	}
+	for _, b := range taken {
+		b.tokens--
+	}
+	if wait == 0 {
+		stat.Allowed++
+		rateLimitLock.Unlock()
+		return nil
+	}
+	rateLimitLock.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		rateLimitLock.Lock()
+		stat.Throttled++
+		stat.Waited += wait
+		rateLimitLock.Unlock()
+		return nil
+	case <-ctx.Done():
+		rateLimitLock.Lock()
+		for _, b := range taken {
+			b.tokens++
+		}
+		stat.Rejected++
+		rateLimitLock.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,66 @@
+package q
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// forgetRateLimit removes the bucket and counts for serverName so the test can be run again from a full bucket
+func forgetRateLimit(serverName string) {
+	rateLimitLock.Lock()
+	delete(buckets, serverName)
+	delete(rateLimitStats, serverName)
+	rateLimitLock.Unlock()
+}
+
+func TestRateLimitFailFast(t *testing.T) {
+	defer forgetRateLimit("test.ratelimit.fast")
+	SetDefaultOptions(RateLimitServer("test.ratelimit.fast", 1, 2), RateLimitFailFast())
+	defer SetDefaultOptions()
+
+	for i := 0; i < 2; i++ {
+		if err := Send("", "test.ratelimit.fast", []byte("message")); err != nil {
+			t.Errorf("Expected send %d to be allowed, got %s", i, err)
+		}
+	}
+	if err := Send("", "test.ratelimit.fast", []byte("message")); err != ErrRateLimited {
+		t.Errorf("Expected ErrRateLimited got %v", err)
+	}
+	stat := RateLimitStats()["test.ratelimit.fast"]
+	if stat.Allowed != 2 || stat.Rejected != 1 {
+		t.Errorf("Expected 2 allowed and 1 rejected, got %d and %d", stat.Allowed, stat.Rejected)
+	}
+}
+
+func TestRateLimitWait(t *testing.T) {
+	defer forgetRateLimit("test.ratelimit.wait")
+	SetDefaultOptions(RateLimit(50, 1))
+	defer SetDefaultOptions()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := Send("", "test.ratelimit.wait", []byte("message")); err != nil {
+			t.Errorf("Expected send %d to wait, got %s", i, err)
+		}
+	}
+	if time.Since(start) < 30*time.Millisecond {
+		t.Errorf("Expected sends to be throttled, took %s", time.Since(start))
+	}
+	if RateLimitStats()["test.ratelimit.wait"].Throttled != 2 {
+		t.Errorf("Expected 2 throttled sends got %d", RateLimitStats()["test.ratelimit.wait"].Throttled)
+	}
+}
+
+func TestRateLimitContext(t *testing.T) {
+	defer forgetRateLimit("test.ratelimit.context")
+	SetDefaultOptions(RateLimitServer("test.ratelimit.context", 0.1, 1))
+	defer SetDefaultOptions()
+
+	Send("", "test.ratelimit.context", []byte("message"))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := SendContext(ctx, "", "test.ratelimit.context", []byte("message")); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package q
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// CloseOnPanic closes a server instance whose handler panics, the other instances keep running
+func CloseOnPanic() Option {
+	return func(t *Options) {
+		t.closeOnPanic = true
+	}
+}
+
+// handle calls the handler for call, converting a panic into a RemoteError
+func (s *server) handle(call *invocation) (reply []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = s.recovered(call, r, debug.Stack())
+		}
+	}()
+	return s.handler(call, call.msg.Subject, call.msg.Data)
+}
+
+// recovered logs and counts a panic in the handler, returning the error to reply with
+func (s *server) recovered(call *invocation, r interface{}, stack []byte) error {
+	traceID := call.headers["traceId"]
+	logf(LogError, "panic in server %s (topic %s, trace %s): %v\n%s", s.id, s.topic, traceID, r, stack)
+	s.lock.Lock()
+	s.panics++
+	s.lock.Unlock()
+	call.panicked = true
+	return &RemoteError{Kind: "panic", Message: fmt.Sprint(r), ServerID: s.id, TraceID: traceID}
+}
+
+// removeInstance closes one instance of a server
+func removeInstance(s *server) {
+	subscriptionsLock.Lock()
+	defer subscriptionsLock.Unlock()
+	services := subscriptions[s.topic]
+	for i, svc := range services {
+		if svc == s {
+			s.unsubscribe()
+			services = append(services[:i:i], services[i+1:]...)
+			break
+		}
+	}
+	if len(services) == 0 {
+		delete(subscriptions, s.topic)
+	} else {
+		subscriptions[s.topic] = services
+		rebalance(s.topic)
+	}
+	if len(subscriptions) == 0 && subscriberCount() == 0 {
+		disconnect()
+	}
+}
@@ -0,0 +1,63 @@
+package q
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Panicky(svr Server, topic string, message []byte) ([]byte, error) {
+	if _, msg := ParseMessage(message); string(msg) == "panic" {
+		panic("oops")
+	}
+	return []byte("calm"), nil
+}
+
+func TestPanicRecovered(t *testing.T) {
+	svr, err := NewTopic("test.panic", Panicky)
+	if err != nil {
+		t.Errorf("TestPanicRecovered NewTopic got %s", err)
+	}
+	defer svr.Close()
+
+	_, err = Request("pid", "test.panic", []byte("panic"), 100*time.Millisecond)
+	if !errors.Is(err, ErrPanic) {
+		t.Errorf("TestPanicRecovered expected ErrPanic got %v", err)
+	}
+	var remote *RemoteError
+	if !errors.As(err, &remote) || remote.Message != "oops" || remote.TraceID != "pid" || remote.ServerID != svr.ID() {
+		t.Errorf("TestPanicRecovered expected oops from %s in trace pid got %#v", svr.ID(), remote)
+	}
+	if svr.(*server).panics != 1 {
+		t.Errorf("TestPanicRecovered expected 1 panic counted got %d", svr.(*server).panics)
+	}
+	reply, err := Request("pid", "test.panic", []byte("again"), 100*time.Millisecond)
+	if err != nil || string(reply) != "calm" {
+		t.Errorf("TestPanicRecovered expected calm got %s, %v", string(reply), err)
+	}
+}
+
+func TestCloseOnPanic(t *testing.T) {
+	svr, err := NewQueue("test.panic.close", "queue", Panicky, CloseOnPanic(), InitialScale(2))
+	if err != nil {
+		t.Errorf("TestCloseOnPanic NewQueue got %s", err)
+	}
+	defer svr.Close()
+
+	_, err = Request("", "test.panic.close", []byte("panic"), 100*time.Millisecond)
+	if !errors.Is(err, ErrPanic) {
+		t.Errorf("TestCloseOnPanic expected ErrPanic got %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if svr.Count() != 1 {
+		t.Errorf("TestCloseOnPanic expected 1 server left got %d", svr.Count())
+	}
+}
+
+func TestPlainError(t *testing.T) {
+	err := parseError([]byte("plain"))
+	var remote *RemoteError
+	if errors.As(err, &remote) || err.Error() != "plain" {
+		t.Errorf("Expected plain error got %#v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package q
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// RetrySettings configures how RetryServer re-invokes a failing handler
+type RetrySettings struct {
+	Attempts   int           // Most calls of the handler including the first, default 3
+	Initial    time.Duration // Delay before the first retry, default 10ms
+	Max        time.Duration // Longest delay between retries, default 1s
+	Multiplier float64       // Growth of the delay after each retry, default 2
+	Jitter     float64       // Fraction of each delay that is randomised, 0-1, default 0.2
+
+	// Retryable returns true if a call failing with err should be retried, default is IsRetryable
+	Retryable func(err error) bool
+}
+
+// withDefaults returns the settings with defaults for unset fields
+func (r RetrySettings) withDefaults() RetrySettings {
+	if r.Attempts < 1 {
+		r.Attempts = 3
+	}
+	if r.Initial <= 0 {
+		r.Initial = 10 * time.Millisecond
+	}
+	if r.Max <= 0 {
+		r.Max = time.Second
+	}
+	if r.Multiplier < 1 {
+		r.Multiplier = 2
+	}
+	if r.Jitter <= 0 || r.Jitter > 1 {
+		r.Jitter = 0.2
+	}
+	if r.Retryable == nil {
+		r.Retryable = IsRetryable
+	}
+	return r
+}
+
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// Retryable marks err as transient so RetryServer retries the call that returned it
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err: err}
+}
+
+// IsRetryable returns true if err was marked with Retryable or says it is temporary
+func IsRetryable(err error) bool {
+	var r *retryableError
+	if errors.As(err, &r) {
+		return true
+	}
+	var t interface{ Temporary() bool }
+	return errors.As(err, &t) && t.Temporary()
+}
+
+// Retry re-invokes each instance's handler when it fails with a retryable error, see RetryServer
+func Retry(settings RetrySettings) Option {
+	settings = settings.withDefaults()
+	return func(t *Options) {
+		t.retry = &settings
+	}
+}
+
+// RetryServer calls server again with exponential backoff and jitter while it fails with a retryable error, giving up
+// after settings.Attempts calls or when the next retry would pass the request's deadline
+func RetryServer(server Handler, settings RetrySettings) Handler {
+	settings = settings.withDefaults()
+	return func(svr Server, topic string, message []byte) ([]byte, error) {
+		ctx := context.Background()
+		if svr != nil {
+			ctx = svr.Context()
+		}
+		delay := settings.Initial
+		for attempt := 1; ; attempt++ {
+			reply, err := server(svr, topic, message)
+			if err == nil || attempt >= settings.Attempts || !settings.Retryable(err) {
+				return reply, err
+			}
+			wait := time.Duration(float64(delay) * (1 + settings.Jitter*(2*rand.Float64()-1)))
+			if d, ok := ctx.Deadline(); ok && time.Until(d) < wait {
+				return reply, err
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return reply, err
+			}
+			delay = time.Duration(float64(delay) * settings.Multiplier)
+			if delay > settings.Max {
+				delay = settings.Max
+			}
+		}
+	}
+}
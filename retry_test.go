@@ -0,0 +1,72 @@
+package q
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Flaky(failures int32, calls *int32, err error) Handler {
+	return func(svr Server, topic string, message []byte) ([]byte, error) {
+		if atomic.AddInt32(calls, 1) <= failures {
+			return nil, err
+		}
+		return []byte("ok"), nil
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	svr, err := NewTopic("test.retry", Flaky(2, &calls, Retryable(errors.New("busy"))), Retry(RetrySettings{Initial: time.Millisecond}))
+	if err != nil {
+		t.Errorf("TestRetry NewTopic got %s", err)
+	}
+	defer svr.Close()
+	reply, err := Request("", "test.retry", []byte("x"), time.Second)
+	if err != nil {
+		t.Errorf("TestRetry Request got %s", err)
+	}
+	if string(reply) != "ok" || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("TestRetry expected ok after 3 calls got %s after %d", reply, calls)
+	}
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	var calls int32
+	handler := RetryServer(Flaky(1, &calls, errors.New("bad request")), RetrySettings{Initial: time.Millisecond})
+	if _, err := handler(nil, "test.retry.notretryable", nil); err == nil || calls != 1 {
+		t.Errorf("TestRetryNotRetryable expected 1 call and an error got %d, %v", calls, err)
+	}
+}
+
+func TestRetryAttempts(t *testing.T) {
+	var calls int32
+	busy := Retryable(errors.New("busy"))
+	handler := RetryServer(Flaky(10, &calls, busy), RetrySettings{Attempts: 4, Initial: time.Millisecond})
+	if _, err := handler(nil, "test.retry.attempts", nil); !errors.Is(err, busy) || calls != 4 {
+		t.Errorf("TestRetryAttempts expected 4 calls and busy got %d, %v", calls, err)
+	}
+}
+
+func TestRetryDeadline(t *testing.T) {
+	var calls int32
+	handler := RetryServer(Flaky(10, &calls, Retryable(errors.New("busy"))), RetrySettings{Attempts: 10, Initial: 20 * time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	svr := &invocation{server: &server{}, ctx: ctx}
+	if _, err := handler(svr, "test.retry.deadline", nil); err == nil {
+		t.Error("TestRetryDeadline expected busy error")
+	}
+	if time.Since(start) > 50*time.Millisecond || calls >= 10 {
+		t.Errorf("TestRetryDeadline expected retries to stop before the deadline got %s for %d calls", time.Since(start), calls)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	if IsRetryable(errors.New("x")) || !IsRetryable(Retryable(errors.New("x"))) || Retryable(nil) != nil {
+		t.Error("TestIsRetryable expected only errors wrapped by Retryable to be retryable")
+	}
+}
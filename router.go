@@ -0,0 +1,194 @@
+package q
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNoRoute is returned by a Router when no pattern matches a subject and there is no not found handler
+var ErrNoRoute = errors.New("no route")
+
+// Router dispatches the messages of one wildcard server to handlers by subject pattern.  A pattern is a subject
+// whose tokens may be {name} to match any token as the parameter name, * to match any token or a final > to match
+// the remaining tokens.  When patterns overlap the most specific wins, comparing tokens left to right a literal
+// beats a parameter or * which beats >.
+type Router struct {
+	routes   []route
+	notFound Handler
+	lock     sync.RWMutex
+}
+
+type route struct {
+	pattern string
+	tokens  []string
+	handler Handler
+}
+
+// NewRouter returns an empty router, serve it with NewTopic(router.Subject(), router.Serve)
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Handle routes subjects matching pattern to handler
+func (r *Router) Handle(pattern string, handler Handler) error {
+	tokens := strings.Split(pattern, ".")
+	names := make(map[string]bool)
+	for i, token := range tokens {
+		switch {
+		case token == ">" && i == len(tokens)-1, token == "*":
+		case strings.HasPrefix(token, "{") && strings.HasSuffix(token, "}"):
+			name := token[1 : len(token)-1]
+			if !IsValidRequestName(name) || strings.Contains(name, ".") || names[name] {
+				return fmt.Errorf("pattern '%s' has an invalid parameter '%s'", pattern, token)
+			}
+			names[name] = true
+		case IsValidRequestName(token):
+		default:
+			return fmt.Errorf("pattern '%s' is not valid", pattern)
+		}
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, rt := range r.routes {
+		if rt.pattern == pattern {
+			return fmt.Errorf("pattern '%s' is already routed", pattern)
+		}
+	}
+	r.routes = append(r.routes, route{pattern: pattern, tokens: tokens, handler: handler})
+	sort.SliceStable(r.routes, func(i, j int) bool { return moreSpecific(r.routes[i].tokens, r.routes[j].tokens) })
+	return nil
+}
+
+// NotFound sets the handler called for subjects no pattern matches
+func (r *Router) NotFound(handler Handler) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.notFound = handler
+}
+
+// Subject returns the wildcard subject that covers every pattern
+func (r *Router) Subject() string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if len(r.routes) == 0 {
+		return ">"
+	}
+	subject := wildcard(r.routes[0].tokens)
+	for _, rt := range r.routes[1:] {
+		other := wildcard(rt.tokens)
+		end := len(subject) // Patterns of different lengths only share a > before the end of the shorter
+		if len(other) < end {
+			end = len(other) - 1
+		} else if len(other) > end {
+			end--
+		}
+		var merged []string
+		for i := 0; i < len(subject) && i < len(other); i++ {
+			if i == end || subject[i] == ">" || other[i] == ">" {
+				merged = append(merged, ">")
+				break
+			}
+			if subject[i] == other[i] {
+				merged = append(merged, subject[i])
+			} else {
+				merged = append(merged, "*")
+			}
+		}
+		subject = merged
+	}
+	return strings.Join(subject, ".")
+}
+
+// Serve is the Handler that dispatches to the handler of the most specific matching pattern
+func (r *Router) Serve(svr Server, topic string, message []byte) ([]byte, error) {
+	r.lock.RLock()
+	handler := r.notFound
+	var params map[string]string
+	for _, rt := range r.routes {
+		if p, ok := match(rt.tokens, topic); ok {
+			handler, params = rt.handler, p
+			break
+		}
+	}
+	r.lock.RUnlock()
+	if handler == nil {
+		return nil, fmt.Errorf("%w for '%s'", ErrNoRoute, topic)
+	}
+	if call, ok := svr.(*invocation); ok {
+		c := *call
+		c.params = params
+		svr = &c
+	}
+	return handler(svr, topic, message)
+}
+
+// Params returns the parameters a Router extracted from the subject of the request being handled
+func Params(svr Server) map[string]string {
+	if call, ok := svr.(*invocation); ok {
+		return call.params
+	}
+	return nil
+}
+
+// Param returns the named parameter a Router extracted from the subject of the request being handled
+func Param(svr Server, name string) string {
+	return Params(svr)[name]
+}
+
+// match returns the parameters of subject if it matches the pattern tokens
+func match(tokens []string, subject string) (map[string]string, bool) {
+	parts := strings.Split(subject, ".")
+	params := make(map[string]string)
+	for i, token := range tokens {
+		if token == ">" {
+			return params, len(parts) > i
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+		switch {
+		case token == "*":
+		case strings.HasPrefix(token, "{"):
+			params[token[1:len(token)-1]] = parts[i]
+		case token != parts[i]:
+			return nil, false
+		}
+	}
+	return params, len(parts) == len(tokens)
+}
+
+// rank orders pattern tokens from most to least specific
+func rank(token string) int {
+	switch {
+	case token == ">":
+		return 2
+	case token == "*" || strings.HasPrefix(token, "{"):
+		return 1
+	}
+	return 0
+}
+
+// moreSpecific returns true if pattern a takes precedence over pattern b
+func moreSpecific(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if ra, rb := rank(a[i]), rank(b[i]); ra != rb {
+			return ra < rb
+		}
+	}
+	return len(a) > len(b)
+}
+
+// wildcard returns the subscription subject tokens for pattern tokens
+func wildcard(tokens []string) []string {
+	subject := make([]string, len(tokens))
+	for i, token := range tokens {
+		if rank(token) == 1 {
+			token = "*"
+		}
+		subject[i] = token
+	}
+	return subject
+}
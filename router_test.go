@@ -0,0 +1,94 @@
+package q
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Route(name string) Handler {
+	return func(svr Server, topic string, message []byte) ([]byte, error) {
+		return []byte(name + ":" + Param(svr, "region") + ":" + Param(svr, "id")), nil
+	}
+}
+
+func TestRouter(t *testing.T) {
+	router := NewRouter()
+	for pattern, name := range map[string]string{
+		"test.orders.{region}.{id}.get": "get",
+		"test.orders.eu.{id}.get":       "eu",
+		"test.orders.{region}.list":     "list",
+		"test.orders.>":                 "rest",
+	} {
+		if err := router.Handle(pattern, Route(name)); err != nil {
+			t.Errorf("TestRouter Handle got %s", err)
+		}
+	}
+	if router.Subject() != "test.orders.>" {
+		t.Errorf("TestRouter expected subject test.orders.> got %s", router.Subject())
+	}
+	svr, err := NewTopic(router.Subject(), router.Serve)
+	if err != nil {
+		t.Errorf("TestRouter NewTopic got %s", err)
+	}
+	defer svr.Close()
+	for subject, expected := range map[string]string{
+		"test.orders.us.42.get":   "get:us:42",
+		"test.orders.eu.7.get":    "eu::7",
+		"test.orders.us.list":     "list:us:",
+		"test.orders.us.42.check": "rest::",
+	} {
+		reply, err := Request("", subject, []byte("x"), time.Second)
+		if err != nil {
+			t.Errorf("TestRouter Request %s got %s", subject, err)
+		}
+		if string(reply) != expected {
+			t.Errorf("TestRouter expected %s for %s got %s", expected, subject, reply)
+		}
+	}
+}
+
+func TestRouterNotFound(t *testing.T) {
+	router := NewRouter()
+	router.Handle("items.{id}", Route("item"))
+	if _, err := router.Serve(nil, "items.1.2", nil); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("TestRouterNotFound expected ErrNoRoute got %v", err)
+	}
+	router.NotFound(Route("missing"))
+	if reply, _ := router.Serve(nil, "items.1.2", nil); string(reply) != "missing::" {
+		t.Errorf("TestRouterNotFound expected not found handler got %s", reply)
+	}
+}
+
+func TestRouterSubject(t *testing.T) {
+	for expected, patterns := range map[string][]string{
+		"a.*.c":   {"a.{x}.c", "a.b.c"},
+		"a.*":     {"a.b", "a.c"},
+		">":       {"a", "a.b"},
+		"a.>":     {"a.b", "a.b.c"},
+		"a.b.*.d": {"a.b.{x}.d"},
+	} {
+		router := NewRouter()
+		for _, p := range patterns {
+			if err := router.Handle(p, Good); err != nil {
+				t.Errorf("TestRouterSubject Handle got %s", err)
+			}
+		}
+		if router.Subject() != expected {
+			t.Errorf("TestRouterSubject expected %s for %v got %s", expected, patterns, router.Subject())
+		}
+	}
+}
+
+func TestRouterInvalidPattern(t *testing.T) {
+	router := NewRouter()
+	for _, p := range []string{"a.>.b", "a..b", "a.{}.b", "a.{x}.{x}", "a b"} {
+		if err := router.Handle(p, Good); err == nil {
+			t.Errorf("TestRouterInvalidPattern expected %s to be invalid", p)
+		}
+	}
+	router.Handle("a.b", Good)
+	if err := router.Handle("a.b", Good); err == nil {
+		t.Error("TestRouterInvalidPattern expected duplicate pattern to fail")
+	}
+}
@@ -1,9 +1,12 @@
 package q
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"sync"
+	"time"
 	"unicode"
 
 	nats "github.com/nats-io/nats.go"
@@ -45,16 +48,45 @@ type Server interface {
 	Count() int
 	Close() error
 	ID() string
+	Context() context.Context
+	Stats() Stats
 }
 
 type server struct {
 	id           string
+	conn         *nats.Conn
 	subscription *nats.Subscription
 	privatesubs  *nats.Subscription
+	cancelsubs   *nats.Subscription
+	healthsubs   []*nats.Subscription
+	describesub  *nats.Subscription
 	topic        string
 	queue        string
 	handler      Handler
 	options      *Options
+	running      map[*invocation]bool
+	lock         sync.Mutex
+	jobs         chan job
+	quit         chan struct{}
+	latency      time.Duration
+	panics       int
+	started      time.Time
+	lastError    string
+	lastErrorAt  time.Time
+	paused       bool
+	requests     int
+	replies      int
+	errors       int
+	bytesIn      int
+	bytesOut     int
+	samples      latencies
+	rejected     int
+	expired      int
+	owned        int
+	retired      bool
+	stopped      bool
+	dispatching  sync.WaitGroup
+	generation   int
 }
 
 // NewTopic returns a new topic server
@@ -68,26 +100,36 @@ func NewQueue(topic, queue string, handler Handler, opts ...Option) (Server, err
 }
 
 // Scale scales the active servers up or down by n
-func (s server) Scale(n int) error {
+func (s *server) Scale(n int) error {
 	return Scale(s.topic, n)
 }
 
 // Count returns the number of active servers
-func (s server) Count() int {
+func (s *server) Count() int {
 	return Count(s.topic)
 }
 
 // Close closes all active servers
-func (s server) Close() error {
+func (s *server) Close() error {
 	return Close(s.topic)
 }
 
 // ID returns the servers unique id
-func (s server) ID() string {
+func (s *server) ID() string {
 	return s.id
 }
 
+// Context returns the context of the request being handled, it is cancelled when the requester gives up
+func (s *server) Context() context.Context {
+	return context.Background()
+}
+
 var subscriptions map[string][]*server = make(map[string][]*server)
+var subscriptionsLock sync.Mutex
+
+// generations numbers each server created by newServer, its instances share the number so a topic that is closed
+// and created again can be told apart
+var generations int
 
 // IsValidServerName returns true if topic is a valid subscription
 func IsValidServerName(name string) bool {
@@ -111,6 +153,8 @@ func IsValidServerName(name string) bool {
 
 // IsServerAvailable returns true if a topic is available
 func IsServerAvailable(topic string) bool {
+	subscriptionsLock.Lock()
+	defer subscriptionsLock.Unlock()
 	_, ok := subscriptions[topic]
 	return !ok
 }
@@ -120,7 +164,9 @@ func newServer(serverName, queueName string, handler Handler, opts ...Option) (S
 	if !IsValidServerName(serverName) {
 		return nil, fmt.Errorf("server '%s' is an invalid name", serverName)
 	}
-	if !IsServerAvailable(serverName) {
+	subscriptionsLock.Lock()
+	defer subscriptionsLock.Unlock()
+	if _, ok := subscriptions[serverName]; ok {
 		return nil, fmt.Errorf("server '%s' already exists", serverName)
 	}
 	options, err := Open(opts...)
@@ -128,14 +174,34 @@ func newServer(serverName, queueName string, handler Handler, opts ...Option) (S
 		return nil, errors.New("No NATS")
 	}
 
+	if options.retry != nil {
+		handler = RetryServer(handler, *options.retry)
+	}
+	handler = Chain(options.middleware...)(handler)
+	if options.handlerTimeout > 0 {
+		handler = TimeoutServer(handler, options.handlerTimeout)
+	}
+	if options.maxInFlight > 0 {
+		ShareBulkhead(NewBulkhead(serverName, options.maxInFlight))(options)
+	}
 	svc, err := new(serverName, queueName, handler, options)
 	if err != nil {
 		return nil, err
 	}
+	generations++
+	svc.generation = generations
 	subscriptions[serverName] = []*server{}
 	subscriptions[serverName] = append(subscriptions[serverName], svc)
+	if err = rebalance(serverName); err != nil {
+		delete(subscriptions, serverName)
+		svc.unsubscribe()
+		return nil, err
+	}
+	if options.autoScale != nil {
+		go autoScale(serverName, svc.generation, *options.autoScale)
+	}
 	if options.scale > 1 {
-		err = Scale(serverName, options.scale-1)
+		err = scaleUp(serverName, options.scale-1)
 		if err != nil {
 			return svc, err
 		}
@@ -151,45 +217,150 @@ func new(serverName, queue string, handler Handler, opt *Options) (*server, erro
 	svc.topic = serverName
 	svc.queue = queue
 	svc.options = opt
+	svc.running = make(map[*invocation]bool)
+	svc.conn = nc
+	svc.started = time.Now()
 
-	if queue == "" {
-		svc.subscription, err = nc.Subscribe(svc.topic, func(m *nats.Msg) {
-			reply, err := svc.handler(svc, m.Subject, m.Data)
-			if err != nil {
-				nc.Publish(m.Reply, []byte(fmt.Sprintf("error:%s", err)))
-			}
-			if m.Reply != "" {
-				nc.Publish(m.Reply, reply)
-			}
-		})
+	if opt.partitioned {
+		svc.startPartition(opt.partitionQueue) // rebalance subscribes the first instance
 	} else {
-		svc.subscription, err = nc.QueueSubscribe(svc.topic, svc.queue, func(m *nats.Msg) {
-			reply, err := svc.handler(svc, m.Subject, m.Data)
-			if err != nil {
-				nc.Publish(m.Reply, []byte(fmt.Sprintf("error:%s", err)))
-			}
-			if m.Reply != "" {
-				nc.Publish(m.Reply, reply)
-			}
-		})
+		if opt.workers > 0 {
+			svc.startWorkers(opt.workers, opt.workerQueue)
+		}
+		if err = svc.subscribe(); err != nil {
+			svc.stopWorkers()
+			return nil, err
+		}
 	}
+	svc.cancelsubs, err = svc.conn.Subscribe(cancelSubject(svc.topic), svc.cancel)
 	if err != nil {
+		svc.unsubscribe()
+		return nil, err
+	}
+	if err = svc.subscribeHealth(); err != nil {
+		svc.unsubscribe()
+		return nil, err
+	}
+	if svc.describesub, err = svc.conn.Subscribe(describeSubject(svc.topic), svc.describe); err != nil {
+		svc.unsubscribe()
 		return nil, err
 	}
 	if opt.privateSubs {
-		svc.privatesubs, err = nc.Subscribe(svc.id, func(m *nats.Msg) {
-			reply, err := svc.handler(svc, m.Subject, m.Data)
-			if err != nil {
-				nc.Publish(m.Reply, []byte("error"))
-			}
-			if m.Reply != "" && reply != nil {
-				nc.Publish(m.Reply, reply)
+		svc.privatesubs, err = svc.conn.Subscribe(svc.id, func(m *nats.Msg) {
+			if headers, _ := ParseMessage(m.Data); headers[cancelHeader] != "" {
+				svc.cancel(m)
+				return
 			}
+			// Requests for this instance are admitted and handled like those on its topic
+			svc.receive(m)
 		})
 	}
 	return &svc, nil
 }
 
+// subscribe subscribes the instance to its topic
+func (s *server) subscribe() error {
+	var sub *nats.Subscription
+	var err error
+	if s.queue == "" {
+		sub, err = s.conn.Subscribe(s.topic, s.receive)
+	} else {
+		sub, err = s.conn.QueueSubscribe(s.topic, s.queue, s.receive)
+	}
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.subscription = sub
+	s.lock.Unlock()
+	return nil
+}
+
+// invocation is the Server passed to a handler, it carries the message being handled
+type invocation struct {
+	*server
+	msg      *nats.Msg
+	headers  map[string]string
+	parts    int
+	ctx      context.Context
+	stop     context.CancelFunc
+	start    time.Time
+	panicked bool
+	params   map[string]string
+}
+
+// Context returns the context of the request being handled, it is cancelled when the requester gives up
+func (call *invocation) Context() context.Context {
+	return call.ctx
+}
+
+// invoke starts handling m, received at received, finish must be called when done
+func (s *server) invoke(m *nats.Msg, received time.Time) *invocation {
+	headers, _ := ParseMessage(m.Data)
+	call := &invocation{server: s, msg: m, headers: headers, start: time.Now()}
+	call.ctx, call.stop = requestContext(headers, received)
+	s.lock.Lock()
+	s.running[call] = true
+	s.requests++
+	s.bytesIn += len(m.Data)
+	s.lock.Unlock()
+	return call
+}
+
+func (s *server) finish(call *invocation) {
+	s.lock.Lock()
+	delete(s.running, call)
+	s.latency += (time.Since(call.start) - s.latency) / 8
+	s.samples.add(time.Since(call.start))
+	s.lock.Unlock()
+	call.stop()
+	if call.panicked && s.options.closeOnPanic {
+		removeInstance(s)
+	}
+}
+
+// cancel cancels the running request with the request id of a cancel notice, or those with its trace id if it has none
+func (s *server) cancel(m *nats.Msg) {
+	headers, _ := ParseMessage(m.Data)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for call := range s.running {
+		if id := headers[requestIDHeader]; id != "" {
+			if call.headers[requestIDHeader] == id {
+				call.stop()
+			}
+		} else if call.headers["traceId"] == headers["traceId"] {
+			call.stop()
+		}
+	}
+}
+
+// serve calls the handler for j's message and publishes its reply
+func (s *server) serve(j job) {
+	defer s.release()
+	m := j.msg
+	call := s.invoke(m, j.received)
+	defer s.finish(call)
+	if call.ctx.Err() != nil {
+		// The requester has already given up
+		s.lock.Lock()
+		s.expired++
+		s.lock.Unlock()
+		logf(LogDebug, "dropped expired request (topic %s, trace %s)", s.topic, call.headers["traceId"])
+		return
+	}
+	reply, err := s.handle(call)
+	if err != nil {
+		s.failed(call, err)
+		s.reply(m.Reply, errorReply(err))
+		return
+	}
+	if call.headers[streamHeader] != "" {
+		reply = ReplyWithHeaders(reply, Header{Key: streamEndHeader, Value: "true"})
+	}
+	s.reply(m.Reply, reply)
+}
+
 func scaleUp(topic string, n int) error {
 	services, ok := subscriptions[topic]
 	if !ok || len(services) == 0 {
@@ -202,6 +373,10 @@ func scaleUp(topic string, n int) error {
 		if err != nil {
 			return err
 		}
+		if s.paused {
+			svc.pause()
+		}
+		svc.generation = s.generation
 		services = append(services, svc)
 	}
 	subscriptions[topic] = services
@@ -218,9 +393,7 @@ func scaleDown(topic string, n int) error {
 		if len(services) == 0 {
 			break
 		}
-		s := services[len(services)-1]
-		s.subscription.Unsubscribe()
-		s.privatesubs.Unsubscribe()
+		services[len(services)-1].unsubscribe()
 		services = services[:len(services)-1]
 	}
 	if len(services) == 0 {
@@ -228,14 +401,30 @@ func scaleDown(topic string, n int) error {
 	} else {
 		subscriptions[topic] = services
 	}
-	if len(subscriptions) == 0 {
-		close()
+	if len(subscriptions) == 0 && subscriberCount() == 0 {
+		disconnect()
 	}
 	return nil
 }
 
+// unsubscribe stops the instance receiving messages
+func (s *server) unsubscribe() {
+	s.lock.Lock()
+	s.subscription.Unsubscribe()
+	s.lock.Unlock()
+	s.privatesubs.Unsubscribe()
+	s.cancelsubs.Unsubscribe()
+	s.describesub.Unsubscribe()
+	for _, sub := range s.healthsubs {
+		sub.Unsubscribe()
+	}
+	s.stopWorkers()
+}
+
 // Scale scales the number of servers by n
 func Scale(topic string, n int) error {
+	subscriptionsLock.Lock()
+	defer subscriptionsLock.Unlock()
 	if n > 0 {
 		return scaleUp(topic, n)
 	} else if n < 0 {
@@ -246,6 +435,8 @@ func Scale(topic string, n int) error {
 
 // Count returns the number of active servers for a topic
 func Count(topic string) int {
+	subscriptionsLock.Lock()
+	defer subscriptionsLock.Unlock()
 	services, ok := subscriptions[topic]
 	if !ok {
 		return 0
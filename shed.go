@@ -0,0 +1,144 @@
+package q
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// ErrOverloaded is matched by errors.Is when a server rejected a request because it was overloaded
+var ErrOverloaded = errors.New("server overloaded")
+
+// Bulkhead caps the requests being handled across every server that shares it
+type Bulkhead struct {
+	name     string
+	max      int
+	inFlight int
+	rejected int
+	lock     sync.Mutex
+}
+
+// NewBulkhead returns a bulkhead allowing max requests to be handled at once
+func NewBulkhead(name string, max int) *Bulkhead {
+	if max < 1 {
+		log.Fatal(fmt.Sprintf("Bulkhead max '%d' is not valid, must be >0", max))
+	}
+	return &Bulkhead{name: name, max: max}
+}
+
+// Name returns the name of the bulkhead
+func (b *Bulkhead) Name() string {
+	return b.name
+}
+
+// InFlight returns the number of requests being handled
+func (b *Bulkhead) InFlight() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.inFlight
+}
+
+// Rejected returns the number of requests rejected because the bulkhead was full
+func (b *Bulkhead) Rejected() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.rejected
+}
+
+func (b *Bulkhead) acquire() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.inFlight >= b.max {
+		b.rejected++
+		return false
+	}
+	b.inFlight++
+	return true
+}
+
+func (b *Bulkhead) release() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.inFlight--
+}
+
+// ShareBulkhead makes a server's requests count against bulkhead, requests are rejected while it is full
+func ShareBulkhead(bulkhead *Bulkhead) Option {
+	return func(t *Options) {
+		t.bulkheads = append(append([]*Bulkhead(nil), t.bulkheads...), bulkhead)
+	}
+}
+
+// MaxInFlight rejects requests to a server while n of them are being handled or queued for a worker by its instances
+func MaxInFlight(n int) Option {
+	if n < 1 {
+		log.Fatal(fmt.Sprintf("MaxInFlight '%d' is not valid, must be >0", n))
+	}
+	return func(t *Options) {
+		t.maxInFlight = n
+	}
+}
+
+// MaxQueueDepth rejects requests to an instance once n are waiting to be handled by it
+func MaxQueueDepth(n int) Option {
+	if n < 1 {
+		log.Fatal(fmt.Sprintf("MaxQueueDepth '%d' is not valid, must be >0", n))
+	}
+	return func(t *Options) {
+		t.maxQueueDepth = n
+	}
+}
+
+// receive admits m and passes it to the workers or serves it
+func (s *server) receive(m *nats.Msg) {
+	if !s.admit(m) {
+		return
+	}
+	j := job{msg: m, received: time.Now()}
+	if s.options.partitioned {
+		s.route(j)
+	} else if s.options.workers > 0 {
+		s.dispatch(j)
+	} else {
+		s.serve(j)
+	}
+}
+
+// admit takes a place in each of the server's bulkheads for m, replying with an overloaded error if it cannot
+func (s *server) admit(m *nats.Msg) bool {
+	// The subscription's pending messages include m while it is being delivered
+	if max := s.options.maxQueueDepth; max > 0 && s.queued()+s.pending()-1 >= max {
+		s.overloaded(m, fmt.Sprintf("queue depth over %d", max))
+		return false
+	}
+	for i, b := range s.options.bulkheads {
+		if !b.acquire() {
+			for _, acquired := range s.options.bulkheads[:i] {
+				acquired.release()
+			}
+			s.overloaded(m, fmt.Sprintf("bulkhead %s is full", b.name))
+			return false
+		}
+	}
+	return true
+}
+
+// release gives up the places in the server's bulkheads taken by admit
+func (s *server) release() {
+	for _, b := range s.options.bulkheads {
+		b.release()
+	}
+}
+
+// overloaded rejects m
+func (s *server) overloaded(m *nats.Msg, reason string) {
+	headers, _ := ParseMessage(m.Data)
+	s.lock.Lock()
+	s.rejected++
+	s.lock.Unlock()
+	s.reply(m.Reply, errorReply(&RemoteError{Kind: "overloaded", Message: reason, ServerID: s.id, TraceID: headers["traceId"]}))
+}
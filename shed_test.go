@@ -0,0 +1,98 @@
+package q
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// requestAll sends n concurrent requests to serverName and returns how many were rejected as overloaded
+func requestAll(t *testing.T, serverName string, n int) int {
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	overloaded := 0
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := Request("", serverName, []byte("x"), time.Second)
+			if errors.Is(err, ErrOverloaded) {
+				lock.Lock()
+				overloaded++
+				lock.Unlock()
+			} else if err != nil {
+				t.Errorf("requestAll %s expected overloaded or success got %s", serverName, err)
+			}
+		}()
+		time.Sleep(5 * time.Millisecond)
+	}
+	wg.Wait()
+	return overloaded
+}
+
+func TestMaxInFlight(t *testing.T) {
+	svr, err := NewTopic("test.shed.inflight", Sleepy, Workers(3, 0), MaxInFlight(1))
+	if err != nil {
+		t.Errorf("TestMaxInFlight NewTopic got %s", err)
+	}
+	defer svr.Close()
+	if overloaded := requestAll(t, "test.shed.inflight", 3); overloaded != 2 {
+		t.Errorf("TestMaxInFlight expected 2 overloaded got %d", overloaded)
+	}
+	if rejected := svr.Stats().Rejected; rejected != 2 {
+		t.Errorf("TestMaxInFlight expected 2 rejected in stats got %d", rejected)
+	}
+}
+
+func TestSharedBulkhead(t *testing.T) {
+	bulkhead := NewBulkhead("shared", 1)
+	a, err := NewTopic("test.shed.shared.a", Sleepy, ShareBulkhead(bulkhead))
+	if err != nil {
+		t.Errorf("TestSharedBulkhead NewTopic got %s", err)
+	}
+	defer a.Close()
+	b, err := NewTopic("test.shed.shared.b", Sleepy, ShareBulkhead(bulkhead))
+	if err != nil {
+		t.Errorf("TestSharedBulkhead NewTopic got %s", err)
+	}
+	defer b.Close()
+	done := make(chan error)
+	go func() {
+		_, err := Request("", "test.shed.shared.a", []byte("x"), time.Second)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if _, err = Request("", "test.shed.shared.b", []byte("x"), time.Second); !errors.Is(err, ErrOverloaded) {
+		t.Errorf("TestSharedBulkhead expected overloaded from shared bulkhead got %v", err)
+	}
+	if err = <-done; err != nil {
+		t.Errorf("TestSharedBulkhead Request got %s", err)
+	}
+	if bulkhead.InFlight() != 0 || bulkhead.Rejected() != 1 {
+		t.Errorf("TestSharedBulkhead expected empty bulkhead with 1 rejected got %d, %d", bulkhead.InFlight(), bulkhead.Rejected())
+	}
+}
+
+func TestMaxQueueDepth(t *testing.T) {
+	svr, err := NewQueue("test.shed.queue", "queue", Sleepy, Workers(1, 10), MaxQueueDepth(1))
+	if err != nil {
+		t.Errorf("TestMaxQueueDepth NewQueue got %s", err)
+	}
+	defer svr.Close()
+	if overloaded := requestAll(t, "test.shed.queue", 4); overloaded != 2 {
+		t.Errorf("TestMaxQueueDepth expected 2 overloaded got %d", overloaded)
+	}
+}
+
+func TestMaxInFlightInstance(t *testing.T) {
+	svr, err := NewTopic("test.shed.instance", Sleepy, Workers(3, 0), MaxInFlight(1))
+	if err != nil {
+		t.Errorf("TestMaxInFlightInstance NewTopic got %s", err)
+	}
+	defer svr.Close()
+	// Requests to an instance's id are admitted like those to its topic
+	if overloaded := requestAll(t, svr.ID(), 3); overloaded != 2 {
+		t.Errorf("TestMaxInFlightInstance expected 2 overloaded got %d", overloaded)
+	}
+}
@@ -0,0 +1,101 @@
+package q
+
+import (
+	"time"
+)
+
+// Stats are the runtime statistics of a server, for a topic they are the totals of its instances
+type Stats struct {
+	ServerID  string        `json:"serverId,omitempty"`
+	Topic     string        `json:"topic"`
+	Paused    bool          `json:"paused,omitempty"`
+	Requests  int           `json:"requests"`
+	Replies   int           `json:"replies"`
+	Errors    int           `json:"errors"`
+	Panics    int           `json:"panics"`
+	Rejected  int           `json:"rejected"`
+	Expired   int           `json:"expired"`
+	InFlight  int           `json:"inFlight"`
+	Queued    int           `json:"queued"`
+	Pending   int           `json:"pending"`
+	BytesIn   int           `json:"bytesIn"`
+	BytesOut  int           `json:"bytesOut"`
+	P50       time.Duration `json:"p50"`
+	P90       time.Duration `json:"p90"`
+	P99       time.Duration `json:"p99"`
+	Instances []Stats       `json:"instances,omitempty"`
+}
+
+// Stats returns the statistics of the server's topic, with those of each instance in Instances
+func (s *server) Stats() Stats {
+	subscriptionsLock.Lock()
+	defer subscriptionsLock.Unlock()
+	return topicStats(s.topic, subscriptions[s.topic])
+}
+
+// StatsSnapshot returns the statistics of every server in this process by topic
+func StatsSnapshot() map[string]Stats {
+	subscriptionsLock.Lock()
+	defer subscriptionsLock.Unlock()
+	stats := make(map[string]Stats, len(subscriptions))
+	for topic, services := range subscriptions {
+		stats[topic] = topicStats(topic, services)
+	}
+	return stats
+}
+
+// topicStats totals the statistics of the instances of topic, subscriptionsLock must be held
+func topicStats(topic string, services []*server) Stats {
+	t := Stats{Topic: topic}
+	var samples []time.Duration
+	for _, s := range services {
+		i, instanceSamples := s.stats()
+		t.Paused = t.Paused || i.Paused
+		t.Requests += i.Requests
+		t.Replies += i.Replies
+		t.Errors += i.Errors
+		t.Panics += i.Panics
+		t.Rejected += i.Rejected
+		t.Expired += i.Expired
+		t.InFlight += i.InFlight
+		t.Queued += i.Queued
+		t.Pending += i.Pending
+		t.BytesIn += i.BytesIn
+		t.BytesOut += i.BytesOut
+		t.Instances = append(t.Instances, i)
+		samples = append(samples, instanceSamples...)
+	}
+	t.P50, t.P90, t.P99 = percentileOf(samples, 50), percentileOf(samples, 90), percentileOf(samples, 99)
+	return t
+}
+
+// stats returns the statistics of the instance and its recent latencies, subscriptionsLock must be held
+func (s *server) stats() (Stats, []time.Duration) {
+	i := Stats{ServerID: s.id, Topic: s.topic, Paused: s.paused, Queued: s.queued(), Pending: s.pending()}
+	s.lock.Lock()
+	i.Requests = s.requests
+	i.Replies = s.replies
+	i.Errors = s.errors
+	i.Panics = s.panics
+	i.Rejected = s.rejected
+	i.Expired = s.expired
+	i.InFlight = len(s.running)
+	i.BytesIn = s.bytesIn
+	i.BytesOut = s.bytesOut
+	samples := append([]time.Duration(nil), s.samples.samples...)
+	s.lock.Unlock()
+	i.P50, i.P90, i.P99 = percentileOf(samples, 50), percentileOf(samples, 90), percentileOf(samples, 99)
+	return i, samples
+}
+
+// reply publishes a reply to subject and counts it
+func (s *server) reply(subject string, data []byte) {
+	if subject == "" {
+		return
+	}
+	s.lock.Lock()
+	s.replies++
+	s.bytesOut += len(data)
+	s.lock.Unlock()
+	s.conn.Publish(subject, data)
+}
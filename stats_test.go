@@ -0,0 +1,53 @@
+package q
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	svr, err := NewTopic("test.stats", SimpleServer, InitialScale(2))
+	if err != nil {
+		t.Errorf("TestStats NewTopic got %s", err)
+	}
+	defer svr.Close()
+	for i := 0; i < 4; i++ {
+		if _, err = Request("", "test.stats", []byte("x"), time.Second); err != nil {
+			t.Errorf("TestStats Request got %s", err)
+		}
+	}
+	time.Sleep(10 * time.Millisecond) // Latencies are recorded after replying
+	stats := svr.Stats()
+	if stats.Topic != "test.stats" || len(stats.Instances) != 2 {
+		t.Errorf("TestStats expected test.stats with 2 instances got %+v", stats)
+		return
+	}
+	// A topic server gets every request on every instance
+	if stats.Requests != 8 || stats.Replies != 8 || stats.Errors != 0 {
+		t.Errorf("TestStats expected 8 requests and replies got %+v", stats)
+	}
+	if stats.BytesIn == 0 || stats.BytesOut == 0 {
+		t.Errorf("TestStats expected bytes to be counted got %+v", stats)
+	}
+	if stats.P50 <= 0 || stats.P99 < stats.P50 {
+		t.Errorf("TestStats expected latencies got p50 %s p99 %s", stats.P50, stats.P99)
+	}
+	if stats.Instances[0].ServerID == "" || stats.Instances[0].Requests != 4 {
+		t.Errorf("TestStats expected 4 requests on the instance got %+v", stats.Instances[0])
+	}
+	if s, ok := StatsSnapshot()["test.stats"]; !ok || s.Requests != 8 {
+		t.Errorf("TestStats expected test.stats in snapshot got %+v", s)
+	}
+}
+
+func TestStatsErrors(t *testing.T) {
+	svr, err := NewTopic("test.stats.errors", Bad)
+	if err != nil {
+		t.Errorf("TestStatsErrors NewTopic got %s", err)
+	}
+	defer svr.Close()
+	Request("", "test.stats.errors", []byte("x"), time.Second)
+	if stats := svr.Stats(); stats.Errors != 1 || stats.Requests != 1 {
+		t.Errorf("TestStatsErrors expected 1 error got %+v", stats)
+	}
+}
@@ -0,0 +1,162 @@
+package q
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const streamHeader = "stream"
+const streamPartHeader = "streamPart"
+const streamEndHeader = "streamEnd"
+
+// ErrNotStream is returned by StreamReply when the request was not made by RequestStream
+var ErrNotStream = errors.New("request is not a stream")
+
+// StreamReply sends part as one of the replies to a request made by RequestStream, waiting until the requester
+// has room for it.  The handler's own reply ends the stream.  An error means the requester has gone away.
+func StreamReply(svr Server, part []byte) error {
+	call, ok := svr.(*invocation)
+	if !ok || call.headers[streamHeader] == "" {
+		return ErrNotStream
+	}
+	timeout, err := time.ParseDuration(call.headers[streamHeader])
+	if err != nil {
+		return err
+	}
+	call.parts++
+	_, err = call.conn.Request(call.msg.Reply, ReplyWithHeaders(part, Header{Key: streamPartHeader, Value: strconv.Itoa(call.parts)}), timeout)
+	return err
+}
+
+type streamPart struct {
+	data []byte
+	err  error
+}
+
+// Stream is the sequence of replies to a request made by RequestStream
+type Stream struct {
+	traceID      string
+	requestID    string
+	serverName   string
+	ctx          context.Context
+	conn         *nats.Conn
+	parts        chan streamPart
+	done         chan struct{}
+	subscription *nats.Subscription
+	timeout      time.Duration
+	err          error
+	closeOnce    sync.Once
+}
+
+// RequestStream sends a request to serverName whose handler replies with StreamReply.  Up to window parts are
+// buffered before the handler has to wait, and Next waits at most partTimeout, which must be >0, for each part.
+func RequestStream(ctx context.Context, traceID, serverName string, message []byte, window int, partTimeout time.Duration, headers ...Header) (*Stream, error) {
+	if !IsValidRequestName((serverName)) {
+		return nil, fmt.Errorf("'%s' was not a valid request name", serverName)
+	}
+	if nc == nil {
+		Open()
+	}
+	if traceID == "" {
+		traceID = NewID()
+	}
+	if window < 1 {
+		window = 1
+	}
+	if partTimeout <= 0 {
+		return nil, fmt.Errorf("part timeout '%s' is not valid, must be >0", partTimeout)
+	}
+	if err := waitRateLimit(ctx, serverName, defaultOptions); err != nil {
+		return nil, err
+	}
+	s := &Stream{traceID: traceID, serverName: serverName, ctx: ctx, conn: nc, parts: make(chan streamPart, window), done: make(chan struct{}), timeout: partTimeout}
+	var err error
+	s.subscription, err = s.conn.Subscribe(nats.NewInbox(), s.receive)
+	if err != nil {
+		return nil, err
+	}
+	headers, s.requestID = withRequestID(deadline(ctx, headers))
+	headers = append(headers, Header{Key: streamHeader, Value: partTimeout.String()})
+	err = s.conn.PublishRequest(serverName, s.subscription.Subject, buildMessage(traceID, message, headers...))
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// receive queues a reply, acknowledging parts once there is room for them
+func (s *Stream) receive(m *nats.Msg) {
+	var part streamPart
+	end := true
+	if strings.HasPrefix(string(m.Data), "error:") {
+		part.err = parseError(m.Data[6:])
+	} else {
+		headers, data := parseReply(m.Data)
+		part.data = data
+		end = headers[streamEndHeader] != ""
+	}
+	if !end || part.err != nil || len(part.data) > 0 {
+		select {
+		case s.parts <- part:
+		case <-s.done:
+			return
+		}
+	}
+	if end {
+		select {
+		case s.parts <- streamPart{err: io.EOF}:
+		case <-s.done:
+		}
+		return
+	}
+	if m.Reply != "" {
+		s.conn.Publish(m.Reply, nil)
+	}
+}
+
+// Next returns the next part of the stream, io.EOF after the last part
+func (s *Stream) Next() ([]byte, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+	select {
+	case part := <-s.parts:
+		if part.err != nil {
+			s.err = part.err
+			s.Close()
+		}
+		return part.data, part.err
+	case <-timer.C:
+		s.err = nats.ErrTimeout
+	case <-s.ctx.Done():
+		s.err = s.ctx.Err()
+	case <-s.done:
+		s.err = nats.ErrBadSubscription
+	}
+	s.Close()
+	return nil, s.err
+}
+
+// Close stops receiving the stream, the server's next StreamReply will fail and its context is cancelled
+func (s *Stream) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		err = s.subscription.Unsubscribe()
+		if s.err == nil || s.err == nats.ErrTimeout || s.err == s.ctx.Err() {
+			cancelRequest(s.traceID, s.requestID, s.serverName)
+		}
+	})
+	return err
+}
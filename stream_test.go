@@ -0,0 +1,115 @@
+package q
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func Pages(svr Server, topic string, message []byte) ([]byte, error) {
+	for _, page := range []string{"one", "two", "three"} {
+		if err := StreamReply(svr, []byte(page)); err != nil {
+			return nil, err
+		}
+	}
+	return []byte("four"), nil
+}
+
+func TestStream(t *testing.T) {
+	svr, err := NewTopic("test.stream", Pages)
+	if err != nil {
+		t.Errorf("TestStream NewTopic got %s", err)
+	}
+	defer svr.Close()
+
+	stream, err := RequestStream(context.Background(), "", "test.stream", []byte{}, 1, 100*time.Millisecond)
+	if err != nil {
+		t.Errorf("TestStream RequestStream got %s", err)
+	}
+	defer stream.Close()
+	for _, expected := range []string{"one", "two", "three", "four"} {
+		part, err := stream.Next()
+		if err != nil || string(part) != expected {
+			t.Errorf("TestStream expected %s got %s, %v", expected, string(part), err)
+		}
+	}
+	if _, err := stream.Next(); err != io.EOF {
+		t.Errorf("TestStream expected io.EOF got %v", err)
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	svr, err := NewTopic("test.stream.error", func(svr Server, topic string, message []byte) ([]byte, error) {
+		StreamReply(svr, []byte("one"))
+		return nil, errors.New("failed")
+	})
+	if err != nil {
+		t.Errorf("TestStreamError NewTopic got %s", err)
+	}
+	defer svr.Close()
+
+	stream, err := RequestStream(context.Background(), "", "test.stream.error", []byte{}, 4, 100*time.Millisecond)
+	if err != nil {
+		t.Errorf("TestStreamError RequestStream got %s", err)
+	}
+	defer stream.Close()
+	if part, _ := stream.Next(); string(part) != "one" {
+		t.Errorf("TestStreamError expected one got %s", string(part))
+	}
+	if _, err := stream.Next(); err == nil || err.Error() != "failed" {
+		t.Errorf("TestStreamError expected failed got %v", err)
+	}
+}
+
+func TestStreamClosed(t *testing.T) {
+	result := make(chan error, 1)
+	svr, err := NewTopic("test.stream.closed", func(svr Server, topic string, message []byte) ([]byte, error) {
+		var err error
+		for i := 0; i < 10 && err == nil; i++ {
+			err = StreamReply(svr, []byte("part"))
+		}
+		result <- err
+		return nil, err
+	})
+	if err != nil {
+		t.Errorf("TestStreamClosed NewTopic got %s", err)
+	}
+	defer svr.Close()
+
+	stream, err := RequestStream(context.Background(), "", "test.stream.closed", []byte{}, 1, 50*time.Millisecond)
+	if err != nil {
+		t.Errorf("TestStreamClosed RequestStream got %s", err)
+	}
+	stream.Next()
+	stream.Close()
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Error("TestStreamClosed expected StreamReply to fail after Close")
+		}
+	case <-time.After(time.Second):
+		t.Error("TestStreamClosed handler did not stop")
+	}
+}
+
+func TestNotStream(t *testing.T) {
+	svr, err := NewTopic("test.stream.not", func(svr Server, topic string, message []byte) ([]byte, error) {
+		return nil, StreamReply(svr, []byte("part"))
+	})
+	if err != nil {
+		t.Errorf("TestNotStream NewTopic got %s", err)
+	}
+	defer svr.Close()
+
+	if _, err := Request("", "test.stream.not", []byte{}, 100*time.Millisecond); err == nil || err.Error() != ErrNotStream.Error() {
+		t.Errorf("TestNotStream expected %s got %v", ErrNotStream, err)
+	}
+}
+
+func TestStreamPartTimeout(t *testing.T) {
+	if _, err := RequestStream(context.Background(), "", "test.stream.timeout", []byte{}, 1, 0); err == nil {
+		t.Error("TestStreamPartTimeout expected a part timeout of 0 to be refused")
+	}
+}
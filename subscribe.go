@@ -0,0 +1,170 @@
+package q
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// Message is a message received by a subscriber
+type Message struct {
+	Subject string
+	Reply   string
+	Headers map[string]string
+	Data    []byte
+}
+
+// TraceID returns the trace id the message was sent with
+func (m *Message) TraceID() string {
+	return m.Headers["traceId"]
+}
+
+// MessageHandler is called for each message received by a subscriber
+type MessageHandler func(*Message)
+
+// Subscription is a subscriber created by Subscribe, QueueSubscribe, SubscribeChan or QueueSubscribeChan
+type Subscription struct {
+	subject      string
+	subscription *nats.Subscription
+	slowConsumer func(subject string, dropped int)
+}
+
+// PendingLimits sets the messages and bytes a subscriber may have waiting before it is a slow consumer and messages are dropped
+func PendingLimits(msgs, bytes int) Option {
+	return func(t *Options) {
+		t.pendingMsgs = msgs
+		t.pendingBytes = bytes
+	}
+}
+
+// OnSlowConsumer sets a function called when a subscriber falls behind and messages are dropped
+func OnSlowConsumer(fn func(subject string, dropped int)) Option {
+	return func(t *Options) {
+		t.slowConsumer = fn
+	}
+}
+
+var subscribers = make(map[*nats.Subscription]*Subscription)
+var subscribersLock sync.Mutex
+
+// Subscribe calls handler for each message sent to subject, no reply is sent
+func Subscribe(subject string, handler MessageHandler, opts ...Option) (*Subscription, error) {
+	return subscribe(subject, "", handler, opts...)
+}
+
+// QueueSubscribe calls handler for each message sent to subject, sharing the messages with the other members of queue
+func QueueSubscribe(subject, queue string, handler MessageHandler, opts ...Option) (*Subscription, error) {
+	return subscribe(subject, queue, handler, opts...)
+}
+
+// SubscribeChan delivers each message sent to subject to ch, when ch is full messages wait up to the pending limits
+func SubscribeChan(subject string, ch chan<- *Message, opts ...Option) (*Subscription, error) {
+	return subscribe(subject, "", func(m *Message) { ch <- m }, opts...)
+}
+
+// QueueSubscribeChan delivers each message sent to subject to ch, sharing the messages with the other members of queue
+func QueueSubscribeChan(subject, queue string, ch chan<- *Message, opts ...Option) (*Subscription, error) {
+	return subscribe(subject, queue, func(m *Message) { ch <- m }, opts...)
+}
+
+func subscribe(subject, queue string, handler MessageHandler, opts ...Option) (*Subscription, error) {
+	if !IsValidServerName(subject) {
+		return nil, fmt.Errorf("subject '%s' is an invalid name", subject)
+	}
+	options, err := Open(opts...)
+	if err != nil {
+		return nil, err
+	}
+	callback := func(m *nats.Msg) {
+		headers, data := map[string]string{}, m.Data
+		// Messages from publishers other than this package have no headers to parse
+		if bytes.HasPrefix(m.Data, []byte(traceIDPrefix)) {
+			headers, data = ParseMessage(m.Data)
+		}
+		handler(&Message{Subject: m.Subject, Reply: m.Reply, Headers: headers, Data: data})
+	}
+	s := &Subscription{subject: subject, slowConsumer: options.slowConsumer}
+	if queue == "" {
+		s.subscription, err = nc.Subscribe(subject, callback)
+	} else {
+		s.subscription, err = nc.QueueSubscribe(subject, queue, callback)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if options.pendingMsgs != 0 || options.pendingBytes != 0 {
+		msgs, bytes := options.pendingMsgs, options.pendingBytes
+		if msgs == 0 {
+			msgs = nats.DefaultSubPendingMsgsLimit
+		}
+		if bytes == 0 {
+			bytes = nats.DefaultSubPendingBytesLimit
+		}
+		if err = s.subscription.SetPendingLimits(msgs, bytes); err != nil {
+			s.subscription.Unsubscribe()
+			return nil, err
+		}
+	}
+	subscribersLock.Lock()
+	subscribers[s.subscription] = s
+	subscribersLock.Unlock()
+	return s, nil
+}
+
+// Subject returns the subject subscribed to
+func (s *Subscription) Subject() string {
+	return s.subject
+}
+
+// Unsubscribe stops delivering messages
+func (s *Subscription) Unsubscribe() error {
+	subscribersLock.Lock()
+	delete(subscribers, s.subscription)
+	subscribersLock.Unlock()
+	return s.subscription.Unsubscribe()
+}
+
+// Pending returns the number of messages waiting to be delivered
+func (s *Subscription) Pending() (int, error) {
+	msgs, _, err := s.subscription.Pending()
+	return msgs, err
+}
+
+// Dropped returns the number of messages dropped because the subscriber was too slow
+func (s *Subscription) Dropped() (int, error) {
+	return s.subscription.Dropped()
+}
+
+// asyncError reports slow consumers to the subscriber's OnSlowConsumer function
+func asyncError(_ *nats.Conn, sub *nats.Subscription, err error) {
+	if err != nats.ErrSlowConsumer || sub == nil {
+		return
+	}
+	subscribersLock.Lock()
+	s, ok := subscribers[sub]
+	subscribersLock.Unlock()
+	if ok && s.slowConsumer != nil {
+		dropped, _ := sub.Dropped()
+		s.slowConsumer(s.subject, dropped)
+	}
+}
+
+// unsubscribeAll removes every subscriber
+func unsubscribeAll() {
+	subscribersLock.Lock()
+	subs := subscribers
+	subscribers = make(map[*nats.Subscription]*Subscription)
+	subscribersLock.Unlock()
+	for sub := range subs {
+		sub.Unsubscribe()
+	}
+}
+
+// subscriberCount returns the number of active subscribers
+func subscriberCount() int {
+	subscribersLock.Lock()
+	defer subscribersLock.Unlock()
+	return len(subscribers)
+}
@@ -0,0 +1,118 @@
+package q
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	received := make(chan *Message, 1)
+	sub, err := Subscribe("test.subscribe", func(m *Message) { received <- m })
+	if err != nil {
+		t.Errorf("TestSubscribe Subscribe got %s", err)
+	}
+	defer sub.Unsubscribe()
+
+	Send("sid", "test.subscribe", []byte("event"))
+	select {
+	case m := <-received:
+		if string(m.Data) != "event" {
+			t.Errorf("TestSubscribe expected event got %s", string(m.Data))
+		}
+		if m.TraceID() != "sid" {
+			t.Errorf("TestSubscribe expected trace sid got %s", m.TraceID())
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Error("TestSubscribe did not receive a message")
+	}
+}
+
+func TestSubscribePlain(t *testing.T) {
+	received := make(chan *Message, 1)
+	sub, err := Subscribe("test.subscribe.plain", func(m *Message) { received <- m })
+	if err != nil {
+		t.Errorf("TestSubscribePlain Subscribe got %s", err)
+	}
+	defer sub.Unsubscribe()
+
+	// A message published without this package's headers is delivered as it was sent
+	nc.Publish("test.subscribe.plain", []byte("hello"))
+	select {
+	case m := <-received:
+		if string(m.Data) != "hello" {
+			t.Errorf("TestSubscribePlain expected hello got %s", string(m.Data))
+		}
+		if len(m.Headers) != 0 {
+			t.Errorf("TestSubscribePlain expected no headers got %v", m.Headers)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Error("TestSubscribePlain did not receive a message")
+	}
+}
+
+func TestSubscribeChan(t *testing.T) {
+	ch := make(chan *Message, 10)
+	sub, err := QueueSubscribeChan("test.subscribe.chan", "queue", ch)
+	if err != nil {
+		t.Errorf("TestSubscribeChan QueueSubscribeChan got %s", err)
+	}
+	defer sub.Unsubscribe()
+
+	for i := 0; i < 3; i++ {
+		Send("", "test.subscribe.chan", []byte("event"))
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-ch:
+		case <-time.After(100 * time.Millisecond):
+			t.Errorf("TestSubscribeChan expected 3 messages got %d", i)
+			return
+		}
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	ch := make(chan *Message, 10)
+	sub, err := SubscribeChan("test.unsubscribe", ch)
+	if err != nil {
+		t.Errorf("TestUnsubscribe SubscribeChan got %s", err)
+	}
+	sub.Unsubscribe()
+	Send("", "test.unsubscribe", []byte("event"))
+	select {
+	case <-ch:
+		t.Error("TestUnsubscribe received a message after Unsubscribe")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSlowConsumer(t *testing.T) {
+	slow := make(chan int, 10)
+	block := make(chan struct{})
+	sub, err := Subscribe("test.slow", func(m *Message) { <-block }, PendingLimits(1, 1024),
+		OnSlowConsumer(func(subject string, dropped int) { slow <- dropped }))
+	if err != nil {
+		t.Errorf("TestSlowConsumer Subscribe got %s", err)
+	}
+	defer sub.Unsubscribe()
+	defer func() { block <- struct{}{} }()
+
+	for i := 0; i < 5; i++ {
+		Send("", "test.slow", []byte("event"))
+	}
+	select {
+	case <-slow:
+	case <-time.After(time.Second):
+		t.Error("TestSlowConsumer expected slow consumer report")
+	}
+	if dropped, _ := sub.Dropped(); dropped == 0 {
+		t.Error("TestSlowConsumer expected dropped messages")
+	}
+}
+
+func TestInvalidSubscribe(t *testing.T) {
+	_, err := Subscribe("bad-subject", func(m *Message) {})
+	if err == nil {
+		t.Error("Invalid subject expected error")
+	}
+}
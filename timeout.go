@@ -0,0 +1,108 @@
+package q
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+const deadlineHeader = "deadline"
+
+// ErrHandlerTimeout is matched by errors.Is when a server's handler took longer than allowed
+var ErrHandlerTimeout = errors.New("handler timed out")
+
+// HandlerTimeout bounds each invocation of a server's handler to d, replying with a timeout error when it is exceeded
+func HandlerTimeout(d time.Duration) Option {
+	return func(t *Options) {
+		t.handlerTimeout = d
+	}
+}
+
+// TimeoutServer returns a timeout error if server takes longer than d or the requester's deadline, the context
+// given to server is cancelled when the time is up so it can stop working
+func TimeoutServer(server Handler, d time.Duration) Handler {
+	return func(svr Server, topic string, message []byte) ([]byte, error) {
+		parent := context.Background()
+		if svr != nil {
+			parent = svr.Context()
+		}
+		ctx, cancel := context.WithTimeout(parent, d)
+		defer cancel()
+
+		type result struct {
+			reply    []byte
+			err      error
+			panicked bool
+		}
+		done := make(chan result, 1)
+		inner := withContext(svr, ctx)
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					// The handler's goroutine is not covered by the recover in handle
+					call, ok := inner.(*invocation)
+					if !ok {
+						logf(LogError, "panic in handler (topic %s): %v\n%s", topic, r, debug.Stack())
+						done <- result{err: &RemoteError{Kind: "panic", Message: fmt.Sprint(r)}, panicked: true}
+						return
+					}
+					done <- result{err: call.recovered(call, r, debug.Stack()), panicked: true}
+				}
+			}()
+			reply, err := server(inner, topic, message)
+			done <- result{reply: reply, err: err}
+		}()
+		select {
+		case r := <-done:
+			if call, ok := svr.(*invocation); ok && r.panicked {
+				call.panicked = true
+			}
+			return r.reply, r.err
+		case <-ctx.Done():
+			e := &RemoteError{Kind: "timeout", Message: ctx.Err().Error()}
+			if call, ok := svr.(*invocation); ok {
+				e.ServerID = call.id
+				e.TraceID = call.headers["traceId"]
+			}
+			return nil, e
+		}
+	}
+}
+
+// withContext returns svr with its context replaced by ctx
+func withContext(svr Server, ctx context.Context) Server {
+	call, ok := svr.(*invocation)
+	if !ok {
+		return svr
+	}
+	c := *call
+	c.ctx = ctx
+	return &c
+}
+
+// deadline returns a header carrying the milliseconds left before ctx's deadline, a duration rather than a time
+// so the server's clock does not have to agree with the requester's
+func deadline(ctx context.Context, headers []Header) []Header {
+	d, ok := ctx.Deadline()
+	if !ok {
+		return headers
+	}
+	// Rounded up so the server never gives up before the requester does
+	remaining := (time.Until(d) + time.Millisecond - 1) / time.Millisecond
+	if remaining < 0 {
+		remaining = 0
+	}
+	return append(append([]Header(nil), headers...), Header{Key: deadlineHeader, Value: strconv.FormatInt(int64(remaining), 10)})
+}
+
+// requestContext returns the context for a request with headers received at received, its deadline is the
+// requester's remaining time counted from then
+func requestContext(headers map[string]string, received time.Time) (context.Context, context.CancelFunc) {
+	if ms, err := strconv.ParseInt(headers[deadlineHeader], 10, 64); err == nil {
+		return context.WithDeadline(context.Background(), received.Add(time.Duration(ms)*time.Millisecond))
+	}
+	return context.WithCancel(context.Background())
+}
@@ -0,0 +1,113 @@
+package q
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHandlerTimeout(t *testing.T) {
+	svr, err := NewTopic("test.timeout", Sleepy, HandlerTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Errorf("TestHandlerTimeout NewTopic got %s", err)
+	}
+	defer svr.Close()
+
+	start := time.Now()
+	_, err = Request("", "test.timeout", []byte{}, time.Second)
+	if !errors.Is(err, ErrHandlerTimeout) {
+		t.Errorf("TestHandlerTimeout expected ErrHandlerTimeout got %v", err)
+	}
+	if time.Since(start) > 40*time.Millisecond {
+		t.Errorf("TestHandlerTimeout expected a quick timeout, took %s", time.Since(start))
+	}
+}
+
+func TestTimeoutServer(t *testing.T) {
+	reply, err := TimeoutServer(SimpleServer, time.Second)(nil, "", nil)
+	if err != nil || string(reply) != "Hello" {
+		t.Errorf("Expected Hello got %s, %v", string(reply), err)
+	}
+	_, err = TimeoutServer(Sleepy, time.Millisecond)(nil, "", nil)
+	if !errors.Is(err, ErrHandlerTimeout) {
+		t.Errorf("Expected ErrHandlerTimeout got %v", err)
+	}
+}
+
+func TestRequestDeadline(t *testing.T) {
+	svr, err := NewTopic("test.deadline", func(svr Server, topic string, message []byte) ([]byte, error) {
+		deadline, ok := svr.Context().Deadline()
+		if !ok {
+			return []byte("none"), nil
+		}
+		return []byte(time.Until(deadline).Round(time.Second).String()), nil
+	})
+	if err != nil {
+		t.Errorf("TestRequestDeadline NewTopic got %s", err)
+	}
+	defer svr.Close()
+
+	reply, err := Request("", "test.deadline", []byte{}, 2*time.Second)
+	if err != nil || string(reply) != "2s" {
+		t.Errorf("TestRequestDeadline expected 2s got %s, %v", string(reply), err)
+	}
+}
+
+func TestExpiredRequest(t *testing.T) {
+	ctx, cancel := requestContext(map[string]string{deadlineHeader: "0"}, time.Now())
+	defer cancel()
+	if ctx.Err() == nil {
+		t.Error("Expected an expired context")
+	}
+	// The deadline counts from when the message was received, not from the requester's clock
+	received := time.Now().Add(-time.Second)
+	ctx, cancel = requestContext(map[string]string{deadlineHeader: "1500"}, received)
+	defer cancel()
+	if d, ok := ctx.Deadline(); !ok || !d.Equal(received.Add(1500*time.Millisecond)) {
+		t.Errorf("TestExpiredRequest expected deadline %s got %s", received.Add(1500*time.Millisecond), d)
+	}
+	ctx, cancel = requestContext(map[string]string{}, time.Now())
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("Expected no deadline without the header")
+	}
+}
+
+func TestExpiredRequestCounted(t *testing.T) {
+	svr, err := NewTopic("test.timeout.expired", Good)
+	if err != nil {
+		t.Errorf("TestExpiredRequestCounted NewTopic got %s", err)
+	}
+	defer svr.Close()
+
+	if err = Send("", "test.timeout.expired", []byte("late"), Header{Key: deadlineHeader, Value: "0"}); err != nil {
+		t.Errorf("TestExpiredRequestCounted Send got %s", err)
+	}
+	reply, err := Request("", "test.timeout.expired", []byte("on time"), time.Second)
+	if err != nil || string(reply) != "good" {
+		t.Errorf("TestExpiredRequestCounted expected good got %s, %v", string(reply), err)
+	}
+	if stats := svr.Stats(); stats.Expired != 1 || stats.Replies != 1 {
+		t.Errorf("TestExpiredRequestCounted expected 1 expired and 1 reply got %d and %d", stats.Expired, stats.Replies)
+	}
+}
+
+func TestHandlerTimeoutPanic(t *testing.T) {
+	svr, err := NewTopic("test.timeout.panic", Panicky, HandlerTimeout(time.Second))
+	if err != nil {
+		t.Errorf("TestHandlerTimeoutPanic NewTopic got %s", err)
+	}
+	defer svr.Close()
+
+	_, err = Request("", "test.timeout.panic", []byte("panic"), time.Second)
+	if !errors.Is(err, ErrPanic) {
+		t.Errorf("TestHandlerTimeoutPanic expected ErrPanic got %v", err)
+	}
+	if stats := svr.Stats(); stats.Panics != 1 {
+		t.Errorf("TestHandlerTimeoutPanic expected 1 panic counted got %d", stats.Panics)
+	}
+	reply, err := Request("", "test.timeout.panic", []byte("again"), time.Second)
+	if err != nil || string(reply) != "calm" {
+		t.Errorf("TestHandlerTimeoutPanic expected calm got %s, %v", string(reply), err)
+	}
+}
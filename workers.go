@@ -0,0 +1,103 @@
+package q
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// job is a message waiting to be handled and when the instance received it
+type job struct {
+	msg      *nats.Msg
+	received time.Time
+}
+
+// Workers gives each server instance n workers handling requests concurrently, with up to queue requests
+// waiting for a worker.  When the queue is full further requests wait in the subscription's pending messages.
+func Workers(n, queue int) Option {
+	if n < 1 {
+		log.Fatal(fmt.Sprintf("Workers '%d' is not valid, must be >0", n))
+	}
+	if queue < 0 {
+		log.Fatal(fmt.Sprintf("Workers queue '%d' is not valid, must be >=0", queue))
+	}
+	return func(t *Options) {
+		t.workers = n
+		t.workerQueue = queue
+	}
+}
+
+// startWorkers starts the worker pool of a server instance, the workers run until the queue is closed and empty
+func (s *server) startWorkers(n, queue int) {
+	s.jobs = make(chan job, queue)
+	for i := 0; i < n; i++ {
+		go func() {
+			for j := range s.jobs {
+				s.serve(j)
+			}
+		}()
+	}
+}
+
+// dispatch passes j to the worker pool, waiting if the queue is full
+func (s *server) dispatch(j job) {
+	s.lock.Lock()
+	if s.stopped {
+		s.lock.Unlock()
+		s.release()
+		return
+	}
+	s.dispatching.Add(1)
+	s.lock.Unlock()
+	defer s.dispatching.Done()
+	s.jobs <- j
+}
+
+// stopWorkers stops the worker pool once the requests already given to it have been handled, it does not wait
+// for them.  A partition likewise handles the requests it has been given before stopping.
+func (s *server) stopWorkers() {
+	if s.jobs == nil {
+		return
+	}
+	if s.options.partitioned {
+		s.retire()
+		return
+	}
+	s.lock.Lock()
+	stopped := s.stopped
+	s.stopped = true
+	s.lock.Unlock()
+	if stopped {
+		return
+	}
+	go func() {
+		// A dispatch that got in before the pool stopped may be waiting for room in the queue
+		s.dispatching.Wait()
+		close(s.jobs)
+	}()
+}
+
+// inFlight returns the number of requests being handled by the instance
+func (s *server) inFlight() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.running)
+}
+
+// queued returns the number of requests waiting for a worker
+func (s *server) queued() int {
+	return len(s.jobs)
+}
+
+// pending returns the number of messages waiting in the instance's subscription
+func (s *server) pending() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	n, _, err := s.subscription.Pending()
+	if err != nil {
+		return 0 // Not subscribed, e.g. paused or a partition
+	}
+	return n
+}
@@ -0,0 +1,90 @@
+package q
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func Sleepy(svr Server, topic string, message []byte) ([]byte, error) {
+	time.Sleep(50 * time.Millisecond)
+	return []byte("awake"), nil
+}
+
+func TestWorkers(t *testing.T) {
+	svr, err := NewQueue("test.workers", "queue", Sleepy, Workers(4, 10))
+	if err != nil {
+		t.Errorf("TestWorkers NewQueue got %s", err)
+	}
+	defer svr.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reply, err := Request("", "test.workers", []byte{}, 150*time.Millisecond)
+			if err != nil || string(reply) != "awake" {
+				t.Errorf("TestWorkers expected awake got %s, %v", string(reply), err)
+			}
+		}()
+	}
+	time.Sleep(25 * time.Millisecond)
+	if n := svr.(*server).inFlight(); n != 4 {
+		t.Errorf("TestWorkers expected 4 in flight got %d", n)
+	}
+	wg.Wait()
+	if svr.Count() != 1 {
+		t.Errorf("TestWorkers expected 1 server got %d", svr.Count())
+	}
+}
+
+func TestWorkersSerial(t *testing.T) {
+	svr, err := NewQueue("test.workers.serial", "queue", Sleepy, Workers(1, 10))
+	if err != nil {
+		t.Errorf("TestWorkersSerial NewQueue got %s", err)
+	}
+	defer svr.Close()
+
+	for i := 0; i < 3; i++ {
+		Send("", "test.workers.serial", []byte{})
+	}
+	time.Sleep(25 * time.Millisecond)
+	if n := svr.(*server).inFlight(); n != 1 {
+		t.Errorf("TestWorkersSerial expected 1 in flight got %d", n)
+	}
+	if n := svr.(*server).queued(); n != 2 {
+		t.Errorf("TestWorkersSerial expected 2 queued got %d", n)
+	}
+}
+
+func TestWorkersScaleDown(t *testing.T) {
+	var lock sync.Mutex
+	handled := 0
+	svr, err := NewQueue("test.workers.scaledown", "queue", func(svr Server, topic string, message []byte) ([]byte, error) {
+		time.Sleep(10 * time.Millisecond)
+		lock.Lock()
+		handled++
+		lock.Unlock()
+		return []byte("done"), nil
+	}, Workers(1, 10), InitialScale(2))
+	if err != nil {
+		t.Errorf("TestWorkersScaleDown NewQueue got %s", err)
+	}
+	defer svr.Close()
+
+	for i := 0; i < 6; i++ {
+		Send("", "test.workers.scaledown", []byte{})
+	}
+	time.Sleep(5 * time.Millisecond)
+	// The removed instance finishes the requests queued for it
+	if err = svr.Scale(-1); err != nil {
+		t.Errorf("TestWorkersScaleDown Scale got %s", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	lock.Lock()
+	defer lock.Unlock()
+	if handled != 6 {
+		t.Errorf("TestWorkersScaleDown expected 6 handled got %d", handled)
+	}
+}